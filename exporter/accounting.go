@@ -0,0 +1,135 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// accountingState is the on-disk representation of the accumulated spend
+type accountingState struct {
+	Timestamp time.Time
+	Pods      map[string]float64
+	Nodes     map[string]float64
+	// FinishedNamespaces and FinishedJobs hold the cost of the pods that terminated
+	FinishedNamespaces map[string]float64
+	FinishedJobs       map[string]float64
+}
+
+// accumulate integrates the hourly cost of pods and nodes over the time elapsed since the last call,
+// costs are considered constant between calls
+func (m *Metrics) accumulate(now time.Time) {
+	m.podsMtx.RLock()
+	defer m.podsMtx.RUnlock()
+	m.nodesMtx.RLock()
+	defer m.nodesMtx.RUnlock()
+	m.spentMtx.Lock()
+	defer m.spentMtx.Unlock()
+
+	hours := now.Sub(m.lastAccounting).Hours()
+	m.lastAccounting = now
+
+	pods := make(map[string]float64, len(m.Pods))
+	for key, pod := range m.Pods {
+		pods[key] = m.podSpent[key] + pod.Cost*hours
+	}
+
+	nodes := make(map[string]float64, len(m.Nodes))
+	for name, node := range m.Nodes {
+		if node.Cost == nil {
+			continue
+		}
+
+		nodes[name] = m.nodeSpent[name] + node.Cost.Total*hours
+	}
+
+	// pods and nodes that are gone are dropped
+	m.podSpent = pods
+	m.nodeSpent = nodes
+}
+
+func (m *Metrics) accountingLoop(ctx context.Context) {
+	ticker := time.NewTicker(m.accountingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.accumulate(now)
+
+			if len(m.stateFile) > 0 {
+				if err := m.saveAccountingState(); err != nil {
+					log.WithError(err).Warn("Failed to write accounting state")
+				}
+			}
+		}
+	}
+}
+
+// loadAccountingState restores the spend accumulated before a restart, the downtime is not accounted
+func (m *Metrics) loadAccountingState() {
+	m.spentMtx.Lock()
+	defer m.spentMtx.Unlock()
+
+	m.podSpent = make(map[string]float64)
+	m.nodeSpent = make(map[string]float64)
+	m.finishedNamespaces = make(map[string]float64)
+	m.finishedJobs = make(map[string]float64)
+	m.lastAccounting = time.Now()
+
+	if len(m.stateFile) == 0 {
+		return
+	}
+
+	data, err := os.ReadFile(m.stateFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithError(err).Warn("Failed to read accounting state")
+		}
+		return
+	}
+
+	var state accountingState
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.WithError(err).Warn("Failed to parse accounting state")
+		return
+	}
+
+	if state.Pods != nil {
+		m.podSpent = state.Pods
+	}
+	if state.Nodes != nil {
+		m.nodeSpent = state.Nodes
+	}
+	if state.FinishedNamespaces != nil {
+		m.finishedNamespaces = state.FinishedNamespaces
+	}
+	if state.FinishedJobs != nil {
+		m.finishedJobs = state.FinishedJobs
+	}
+
+	log.Infof("Loaded accumulated spend of %d pods and %d nodes [saved=%s]", len(m.podSpent), len(m.nodeSpent), state.Timestamp.Format(time.RFC3339))
+}
+
+func (m *Metrics) saveAccountingState() error {
+	m.spentMtx.Lock()
+	data, err := json.Marshal(accountingState{
+		Timestamp: m.lastAccounting,
+		Pods:      m.podSpent,
+		Nodes:     m.nodeSpent,
+
+		FinishedNamespaces: m.finishedNamespaces,
+		FinishedJobs:       m.finishedJobs,
+	})
+	m.spentMtx.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(m.stateFile, data)
+}
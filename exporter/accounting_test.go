@@ -0,0 +1,64 @@
+package exporter
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAccumulate(t *testing.T) {
+	now := time.Now()
+	node := &Node{Name: "node", Cost: &Ec2Cost{Type: "ondemand", Total: 0.1}}
+
+	m := newTestMetrics(&fakePricingProvider{})
+	m.Pods = map[string]*Pod{"default/a": {Node: node, Cost: 0.02}}
+	m.Nodes = map[string]*Node{"node": node, "unpriced": {Name: "unpriced"}}
+	m.podSpent = map[string]float64{"default/a": 1, "default/gone": 5}
+	m.nodeSpent = map[string]float64{"node": 2}
+	m.lastAccounting = now.Add(-30 * time.Minute)
+
+	m.accumulate(now)
+
+	if want := map[string]float64{"default/a": 1 + 0.02/2}; !reflect.DeepEqual(m.podSpent, want) {
+		t.Errorf("got pods spent %v, want %v", m.podSpent, want)
+	}
+	if want := map[string]float64{"node": 2 + 0.1/2}; !reflect.DeepEqual(m.nodeSpent, want) {
+		t.Errorf("got nodes spent %v, want %v", m.nodeSpent, want)
+	}
+	if !m.lastAccounting.Equal(now) {
+		t.Errorf("got last accounting %v, want %v", m.lastAccounting, now)
+	}
+}
+
+func TestAccountingState(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	saved := newTestMetrics(&fakePricingProvider{})
+	saved.stateFile = stateFile
+	saved.loadAccountingState()
+	saved.podSpent["default/a"] = 1.5
+	saved.nodeSpent["node"] = 3
+	if err := saved.saveAccountingState(); err != nil {
+		t.Fatalf("failed to save the accounting state: %v", err)
+	}
+
+	loaded := newTestMetrics(&fakePricingProvider{})
+	loaded.stateFile = stateFile
+	loaded.loadAccountingState()
+
+	if !reflect.DeepEqual(loaded.podSpent, saved.podSpent) || !reflect.DeepEqual(loaded.nodeSpent, saved.nodeSpent) {
+		t.Errorf("got pods %v and nodes %v, want %v and %v", loaded.podSpent, loaded.nodeSpent, saved.podSpent, saved.nodeSpent)
+	}
+}
+
+func TestAccountingStateMissing(t *testing.T) {
+	m := newTestMetrics(&fakePricingProvider{})
+	m.stateFile = filepath.Join(t.TempDir(), "state.json")
+
+	m.loadAccountingState()
+
+	if m.podSpent == nil || m.nodeSpent == nil || len(m.podSpent)+len(m.nodeSpent) > 0 {
+		t.Errorf("got pods %v and nodes %v, want empty counters", m.podSpent, m.nodeSpent)
+	}
+}
@@ -2,11 +2,15 @@ package exporter
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/pricing"
+	pricingtypes "github.com/aws/aws-sdk-go-v2/service/pricing/types"
 )
 
 const (
@@ -35,7 +39,7 @@ type SKU struct {
 	Sku             string
 	EffectiveDate   string
 	OfferTermCode   string
-	TermAttributes  string
+	TermAttributes  map[string]string
 }
 
 type Details struct {
@@ -48,16 +52,152 @@ type Details struct {
 	PricePerUnit map[string]string
 }
 
-func newAWSConfig(ctx context.Context) (aws.Config, error) {
-	region := os.Getenv("AWS_REGION")
+// AWSPricingProvider retrieves instance types and prices from the EC2 and Pricing APIs
+type AWSPricingProvider struct {
+	config  aws.Config
+	filters PricingFilters
+}
+
+// NewAWSPricingProvider creates a provider for region, which falls back to the AWS_REGION environment variable
+func NewAWSPricingProvider(ctx context.Context, region string, filters PricingFilters) (*AWSPricingProvider, error) {
+	cfg, err := newAWSConfig(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AWSPricingProvider{config: cfg, filters: filters}, nil
+}
+
+func (p *AWSPricingProvider) Name() string {
+	return "aws"
+}
+
+func (p *AWSPricingProvider) Region() string {
+	return p.config.Region
+}
+
+func (p *AWSPricingProvider) Fingerprint() string {
+	return pricingFingerprint(p.Name(), p.config.Region, p.filters)
+}
+
+func newAWSConfig(ctx context.Context, region string) (aws.Config, error) {
 	if region == "" {
-		return aws.Config{}, fmt.Errorf("Please configure the AWS_REGION environment variable")
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		return aws.Config{}, fmt.Errorf("Please configure the region or the AWS_REGION environment variable")
 	}
 
-	cfg, err := config.LoadDefaultConfig(ctx)
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
 	if err != nil {
 		return aws.Config{}, err
 	}
 
 	return cfg, nil
 }
+
+// PricingFilters are additional price list attribute filters, they are added to the default
+// filters of each offer and replace them when they set the same attribute
+type PricingFilters struct {
+	EC2 map[string]string `json:"ec2"`
+	EKS map[string]string `json:"eks"`
+}
+
+// ec2 returns the AmazonEC2 filters of a region and operating system, the operating system filters
+// can not be replaced since they select the prices of each operating system
+func (f PricingFilters) ec2(region string, operatingSystem string) map[string]string {
+	filters := mergeFilters(ec2ProductFilters(region, operatingSystem), f.EC2)
+	return mergeFilters(filters, ec2OSFilters(operatingSystem))
+}
+
+// eks returns the AmazonEKS filters of a region
+func (f PricingFilters) eks(region string) map[string]string {
+	return mergeFilters(eksProductFilters(region), f.EKS)
+}
+
+func mergeFilters(filters map[string]string, extra map[string]string) map[string]string {
+	for field, value := range extra {
+		filters[field] = value
+	}
+
+	return filters
+}
+
+// ec2ProductFilters selects the shared tenancy instances of a region and operating system in the AmazonEC2 price list
+func ec2ProductFilters(region string, operatingSystem string) map[string]string {
+	filters := map[string]string{
+		"regionCode":     region,
+		"capacitystatus": "Used",
+		"tenancy":        "Shared",
+		"preInstalledSw": "NA",
+	}
+
+	return mergeFilters(filters, ec2OSFilters(operatingSystem))
+}
+
+// ec2OSFilters selects the products of an operating system with its license included, in the EC2 price list
+// license included products are "No License required" as opposed to "Bring your own license"
+func ec2OSFilters(operatingSystem string) map[string]string {
+	return map[string]string{
+		"operatingSystem": operatingSystems[operatingSystem].PriceList,
+		"licenseModel":    "No License required",
+	}
+}
+
+// eksProductFilters selects the products of a region in the AmazonEKS price list
+func eksProductFilters(region string) map[string]string {
+	return map[string]string{
+		"regionCode": region,
+		"tenancy":    "Shared",
+	}
+}
+
+func (p *AWSPricingProvider) getProducts(ctx context.Context, serviceCode string, filters map[string]string) ([]Pricing, error) {
+	config := p.config
+	config.Region = "us-east-1" // this service is only available in us-east-1
+
+	pricingSvc := pricing.NewFromConfig(config)
+
+	input := &pricing.GetProductsInput{
+		ServiceCode: aws.String(serviceCode),
+		MaxResults:  aws.Int32(100),
+	}
+	for field, value := range filters {
+		input.Filters = append(input.Filters, pricingtypes.Filter{
+			Field: aws.String(field),
+			Type:  pricingtypes.FilterTypeTermMatch,
+			Value: aws.String(value),
+		})
+	}
+
+	pag := pricing.NewGetProductsPaginator(pricingSvc, input)
+
+	products := make([]Pricing, 0)
+	for pag.HasMorePages() {
+		pricelist, err := pag.NextPage(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, price := range pricelist.PriceList {
+			var tmp Pricing
+			json.Unmarshal([]byte(price), &tmp)
+
+			products = append(products, tmp)
+		}
+	}
+
+	return products, nil
+}
+
+// onDemandPrice returns the hourly on-demand price of a product and its description
+func onDemandPrice(product Pricing) (float64, string) {
+	skuOnDemand := product.Product.Sku + "." + TermOnDemand
+	skuOnDemandPerHour := skuOnDemand + "." + TermPerHour
+
+	details := product.Terms.OnDemand[skuOnDemand].PriceDimensions[skuOnDemandPerHour]
+	value, _ := strconv.ParseFloat(details.PricePerUnit["USD"], 64)
+
+	return value, details.Description
+}
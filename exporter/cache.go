@@ -0,0 +1,119 @@
+package exporter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// pricingCacheVersion is part of the cache fingerprint, it is increased when the cached prices change format
+const pricingCacheVersion = 2
+
+// pricingCache is the on-disk representation of the resolved prices
+type pricingCache struct {
+	Fingerprint   string
+	Timestamp     time.Time
+	Instances     map[string]*Instance
+	Volumes       map[string]*VolumePrice
+	LoadBalancers map[string]float64
+	ControlPlane  *ControlPlanePrice
+}
+
+// loadPricingCache loads the cached prices if they were retrieved with the same provider, region and filters,
+// it returns how long until the cached prices should be refreshed, when they expire or are due for the periodic
+// refresh, whichever comes first
+func (m *Metrics) loadPricingCache() (time.Duration, bool) {
+	if len(m.pricingCacheFile) == 0 {
+		return 0, false
+	}
+
+	data, err := os.ReadFile(m.pricingCacheFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithError(err).Warn("Failed to read pricing cache")
+		}
+		return 0, false
+	}
+
+	var cache pricingCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		log.WithError(err).Warn("Failed to parse pricing cache")
+		return 0, false
+	}
+
+	if cache.Fingerprint != m.cacheFingerprint() {
+		log.Info("Pricing cache was created with a different provider, region, filters or options, ignoring it")
+		return 0, false
+	}
+
+	if cache.Volumes == nil || cache.LoadBalancers == nil || cache.ControlPlane == nil {
+		log.Info("Pricing cache does not have EBS, load balancer or control plane prices, ignoring it")
+		return 0, false
+	}
+
+	m.setVolumePrices(cache.Volumes)
+	m.setLoadBalancerPrices(cache.LoadBalancers)
+	m.setControlPlanePrice(cache.ControlPlane)
+	m.setPricingHealth(nil)
+	m.setInstances(cache.Instances)
+	m.pricingLastRefresh.Set(float64(cache.Timestamp.Unix()))
+
+	age := time.Since(cache.Timestamp)
+	log.Infof("Loaded pricing of %d instance types from cache [age=%s]", len(cache.Instances), age.Round(time.Second))
+
+	next := m.pricingCacheTTL - age
+	if m.pricingRefreshInterval > 0 && m.pricingRefreshInterval-age < next {
+		// e.g. spot prices must not be older than the refresh interval after a restart
+		next = m.pricingRefreshInterval - age
+	}
+	if next < 0 {
+		return 0, true
+	}
+
+	return next, true
+}
+
+// savePricingCache writes the resolved prices of cache, its fingerprint and timestamp are set to the current ones
+func (m *Metrics) savePricingCache(cache pricingCache) error {
+	cache.Fingerprint = m.cacheFingerprint()
+	cache.Timestamp = time.Now()
+
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(m.pricingCacheFile, data)
+}
+
+// writeFileAtomic writes to a temporary file first so a crash never leaves a truncated file behind
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// cacheFingerprint identifies the provider fingerprint and the options used to resolve the cached prices
+func (m *Metrics) cacheFingerprint() string {
+	options, _ := json.Marshal([]interface{}{pricingCacheVersion, m.overrides, m.cpuMemRatioStrategy, m.cpuMemRatio, m.cpuMemRatioOverrides})
+
+	sum := sha256.Sum256([]byte(m.pricing.Fingerprint() + "/" + string(options)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,91 @@
+package exporter
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLoadPricingCache(t *testing.T) {
+	tests := []struct {
+		name            string
+		age             time.Duration
+		ttl             time.Duration
+		refreshInterval time.Duration
+		fingerprint     string
+		withoutVolumes  bool
+		wantLoaded      bool
+		wantNext        time.Duration
+	}{
+		{name: "due for the periodic refresh", age: 10 * time.Minute, ttl: 24 * time.Hour, refreshInterval: time.Hour, wantLoaded: true, wantNext: 50 * time.Minute},
+		{name: "expires before the periodic refresh", age: 10 * time.Minute, ttl: 30 * time.Minute, refreshInterval: time.Hour, wantLoaded: true, wantNext: 20 * time.Minute},
+		{name: "periodic refresh disabled", age: time.Hour, ttl: 24 * time.Hour, wantLoaded: true, wantNext: 23 * time.Hour},
+		{name: "expired", age: 2 * time.Hour, ttl: time.Hour, refreshInterval: time.Hour, wantLoaded: true, wantNext: 0},
+		{name: "different fingerprint", age: time.Minute, ttl: time.Hour, fingerprint: "other", wantLoaded: false},
+		{name: "written by an older version", age: time.Minute, ttl: time.Hour, withoutVolumes: true, wantLoaded: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMetrics(&fakePricingProvider{})
+			m.pricingCacheFile = filepath.Join(t.TempDir(), "pricing.json")
+			m.pricingCacheTTL = tt.ttl
+			m.pricingRefreshInterval = tt.refreshInterval
+			m.pricingLastRefresh = prometheus.NewGauge(prometheus.GaugeOpts{Name: "test"})
+
+			cache := pricingCache{
+				Fingerprint:   m.cacheFingerprint(),
+				Timestamp:     time.Now().Add(-tt.age),
+				Instances:     map[string]*Instance{"m5.large": {Type: "m5.large", OS: OSLinux, OnDemandCost: &Ec2Cost{Type: "ondemand", Total: 0.096}}},
+				Volumes:       map[string]*VolumePrice{"gp3": {Storage: 0.08}},
+				LoadBalancers: map[string]float64{LoadBalancerClassic: 0.025},
+				ControlPlane:  &ControlPlanePrice{Standard: 0.1, Extended: 0.6},
+			}
+			if tt.fingerprint != "" {
+				cache.Fingerprint = tt.fingerprint
+			}
+			if tt.withoutVolumes {
+				cache.Volumes = nil
+			}
+			data, err := json.Marshal(cache)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(m.pricingCacheFile, data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			next, loaded := m.loadPricingCache()
+
+			if loaded != tt.wantLoaded {
+				t.Fatalf("got loaded %v, want %v", loaded, tt.wantLoaded)
+			}
+			if !loaded {
+				if len(m.Instances) != 0 {
+					t.Errorf("got instances %v from an ignored cache", m.Instances)
+				}
+				return
+			}
+
+			if diff := next - tt.wantNext; diff > time.Second || diff < -time.Second {
+				t.Errorf("got next refresh in %s, want %s", next, tt.wantNext)
+			}
+			if m.Instances["m5.large"] == nil || !m.pricingLoaded() {
+				t.Errorf("got instances %v loaded %v, want the cached prices", m.Instances, m.pricingLoaded())
+			}
+		})
+	}
+}
+
+func TestLoadPricingCacheMissing(t *testing.T) {
+	m := newTestMetrics(&fakePricingProvider{})
+	m.pricingCacheFile = filepath.Join(t.TempDir(), "pricing.json")
+
+	if _, loaded := m.loadPricingCache(); loaded {
+		t.Error("got a missing cache loaded")
+	}
+}
@@ -0,0 +1,169 @@
+package exporter
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Commitments describes the savings plans and reserved instances covering the on-demand nodes of the cluster
+type Commitments struct {
+	SavingsPlans      []SavingsPlan      `json:"savingsPlans"`
+	ReservedInstances []ReservedInstance `json:"reservedInstances"`
+}
+
+// SavingsPlan discounts the on-demand price of the instances it matches
+type SavingsPlan struct {
+	// Family is the instance family (e.g. m5), empty matches every family like a Compute Savings Plan
+	Family string `json:"family"`
+	// Region is the region where the plan applies, empty matches every region
+	Region string `json:"region"`
+	// Discount is the percentage of the on-demand price saved, between 0 and 100 like the pricing overrides discount
+	Discount float64 `json:"discount"`
+}
+
+// ReservedInstance covers Count on-demand nodes of an instance type
+type ReservedInstance struct {
+	InstanceType string `json:"instanceType"`
+	// AvailabilityZone of a zonal reservation, empty for regional reservations
+	AvailabilityZone string `json:"availabilityZone"`
+	// OS is the platform of the reservation: linux, windows, rhel or suse, empty means linux
+	OS    string `json:"os"`
+	Count int    `json:"count"`
+	// HourlyCost is the effective hourly cost of each instance, including the amortized upfront payment,
+	// the pricing overrides discount and reserved multiplier are applied to it like to every other price
+	HourlyCost float64 `json:"hourlyCost"`
+}
+
+// LoadCommitments reads the commitments from a YAML file
+func LoadCommitments(path string) (*Commitments, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Commitments
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("could not parse commitments %s: %w", path, err)
+	}
+
+	for _, sp := range c.SavingsPlans {
+		if sp.Discount < 0 || sp.Discount > 100 {
+			return nil, fmt.Errorf("savings plan discount must be a percentage between 0 and 100, got %v", sp.Discount)
+		}
+	}
+
+	for _, ri := range c.ReservedInstances {
+		if _, ok := operatingSystems[ri.OS]; ri.OS != "" && !ok {
+			return nil, fmt.Errorf("unknown os %q of reserved instance %s", ri.OS, ri.InstanceType)
+		}
+	}
+
+	return &c, nil
+}
+
+// instanceFamily returns the family of an instance type, e.g. m5 for m5.xlarge
+func instanceFamily(instanceType string) string {
+	return strings.SplitN(instanceType, ".", 2)[0]
+}
+
+// repriceNodes prices every node and allocates the commitments to the on-demand ones,
+// reservations are global so they are allocated again whenever a node is added or removed,
+// except during the initial list which is priced once it completes. Caller must hold the nodes lock.
+func (m *Metrics) repriceNodes() {
+	names := make([]string, 0, len(m.Nodes))
+	for name, node := range m.Nodes {
+		m.priceNode(node)
+		names = append(names, name)
+	}
+
+	if m.commitments == nil {
+		return
+	}
+
+	// allocate in a stable order so nodes do not flip between reserved and on-demand on every update
+	sort.Strings(names)
+
+	reservations := make([]ReservedInstance, len(m.commitments.ReservedInstances))
+	copy(reservations, m.commitments.ReservedInstances)
+	// zonal reservations are more specific, so they are used first
+	sort.SliceStable(reservations, func(i, j int) bool {
+		return reservations[i].AvailabilityZone != "" && reservations[j].AvailabilityZone == ""
+	})
+
+	for _, name := range names {
+		node := m.Nodes[name]
+		if node.Lifecycle != "ondemand" || node.Instance == nil || node.Instance.OnDemandCost == nil {
+			continue
+		}
+		if node.Instance.VCpu == 0 {
+			// the price of the instance type is not loaded, its cost cannot be split between vCPU and memory
+			continue
+		}
+
+		if ri := reservedInstanceFor(node, reservations); ri != nil {
+			ri.Count--
+
+			value, source := m.overrides.apply("reserved", node.Instance, ri.HourlyCost, "commitment")
+			vcpu, memory, gpu := getNormalizedCost(value, node.Instance)
+			node.Cost = &Ec2Cost{Type: "reserved", Total: value, VCpu: vcpu, Memory: memory, Gpu: gpu, Source: source}
+			continue
+		}
+
+		if sp := m.savingsPlanFor(node); sp != nil {
+			// the plan discount applies over the on-demand price with the hourly overrides, the on-demand multiplier
+			// is replaced by the savings plan one
+			value, source := m.overrides.onDemandPrice(node.Instance, node.Instance.OnDemandPrice, m.pricing.Name())
+			value, source = m.overrides.adjust("savingsplan", value*(1-sp.Discount/100), source)
+			vcpu, memory, gpu := getNormalizedCost(value, node.Instance)
+			node.Cost = &Ec2Cost{Type: "savingsplan", Total: value, VCpu: vcpu, Memory: memory, Gpu: gpu, Source: source}
+		}
+	}
+}
+
+// reservedInstanceFor returns a reservation with capacity left that matches the node
+func reservedInstanceFor(node *Node, reservations []ReservedInstance) *ReservedInstance {
+	for i := range reservations {
+		ri := &reservations[i]
+		if ri.Count <= 0 || ri.InstanceType != node.Instance.Type {
+			continue
+		}
+		if ri.AvailabilityZone != "" && ri.AvailabilityZone != node.AZ {
+			continue
+		}
+		if instanceKey(ri.InstanceType, ri.OS) != instanceKey(node.Instance.Type, node.OS) {
+			// reservations only cover their own platform
+			continue
+		}
+
+		return ri
+	}
+
+	return nil
+}
+
+// savingsPlanFor returns the most specific savings plan matching the node, a plan for the node
+// instance family is preferred over a plan for every family
+func (m *Metrics) savingsPlanFor(node *Node) *SavingsPlan {
+	var match *SavingsPlan
+	family := instanceFamily(node.Instance.Type)
+
+	for i := range m.commitments.SavingsPlans {
+		sp := &m.commitments.SavingsPlans[i]
+		if sp.Region != "" && sp.Region != node.Region {
+			continue
+		}
+
+		if sp.Family == family {
+			return sp
+		}
+		if sp.Family == "" && match == nil {
+			match = sp
+		}
+	}
+
+	return match
+}
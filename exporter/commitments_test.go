@@ -0,0 +1,138 @@
+package exporter
+
+import (
+	"testing"
+)
+
+func TestReservedInstanceFor(t *testing.T) {
+	reservations := []ReservedInstance{
+		{InstanceType: "m5.large", AvailabilityZone: "us-east-1a", Count: 1, HourlyCost: 0.05},
+		{InstanceType: "m5.large", Count: 0, HourlyCost: 0.06},
+		{InstanceType: "m5.xlarge", Count: 1, HourlyCost: 0.12},
+		{InstanceType: "m5.xlarge", OS: OSWindows, Count: 1, HourlyCost: 0.2},
+	}
+
+	tests := []struct {
+		name string
+		node *Node
+		want float64
+	}{
+		{"zonal reservation", &Node{AZ: "us-east-1a", OS: OSLinux, Instance: &Instance{Type: "m5.large"}}, 0.05},
+		{"zonal reservation in another zone", &Node{AZ: "us-east-1b", OS: OSLinux, Instance: &Instance{Type: "m5.large"}}, 0},
+		{"regional reservation", &Node{AZ: "us-east-1b", OS: OSLinux, Instance: &Instance{Type: "m5.xlarge"}}, 0.12},
+		{"reservation of the node platform", &Node{AZ: "us-east-1b", OS: OSWindows, Instance: &Instance{Type: "m5.xlarge"}}, 0.2},
+		{"no reservation of the node platform", &Node{AZ: "us-east-1a", OS: OSRHEL, Instance: &Instance{Type: "m5.large"}}, 0},
+		{"no reservation of the instance type", &Node{AZ: "us-east-1a", OS: OSLinux, Instance: &Instance{Type: "c5.large"}}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := float64(0)
+			if ri := reservedInstanceFor(tt.node, reservations); ri != nil {
+				got = ri.HourlyCost
+			}
+
+			if got != tt.want {
+				t.Errorf("got reservation at %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSavingsPlanFor(t *testing.T) {
+	m := newTestMetrics(&fakePricingProvider{})
+	m.commitments = &Commitments{SavingsPlans: []SavingsPlan{
+		{Discount: 10},
+		{Family: "m5", Region: "us-east-1", Discount: 30},
+		{Region: "eu-west-1", Discount: 20},
+	}}
+
+	tests := []struct {
+		name string
+		node *Node
+		want float64
+	}{
+		{"family plan preferred", &Node{Region: "us-east-1", Instance: &Instance{Type: "m5.large"}}, 30},
+		{"compute plan", &Node{Region: "us-east-1", Instance: &Instance{Type: "c5.large"}}, 10},
+		{"family plan of another region", &Node{Region: "eu-west-1", Instance: &Instance{Type: "m5.large"}}, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := m.savingsPlanFor(tt.node)
+			if sp == nil || sp.Discount != tt.want {
+				t.Errorf("got savings plan %+v, want discount %v", sp, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepriceNodes(t *testing.T) {
+	m5 := &Instance{Type: "m5.large", OS: OSLinux, VCpu: 2, Memory: 8192}
+	c5 := &Instance{Type: "c5.large", OS: OSLinux, VCpu: 2, Memory: 4096}
+
+	m := newTestMetrics(&fakePricingProvider{})
+	m.overrides = &PricingOverrides{
+		InstanceTypes: map[string]float64{"c5.large": 0.07},
+		Lifecycles:    map[string]float64{"ondemand": 1.1, "savingsplan": 0.8},
+	}
+	m.priceInstance(m5, 0.1, nil)
+	m.priceInstance(c5, 0.08, nil)
+	m.Instances = map[string]*Instance{"m5.large": m5, "c5.large": c5}
+	m.commitments = &Commitments{
+		SavingsPlans: []SavingsPlan{{Family: "c5", Discount: 25}},
+		ReservedInstances: []ReservedInstance{
+			{InstanceType: "m5.large", Count: 1, HourlyCost: 0.06},
+			{InstanceType: "m6i.large", Count: 1, HourlyCost: 0.06},
+		},
+	}
+
+	newNode := func(name, instanceType, lifecycle string) *Node {
+		return &Node{Name: name, Lifecycle: lifecycle, OS: OSLinux, Instance: &Instance{Type: instanceType}}
+	}
+	m.Nodes = map[string]*Node{
+		"a": newNode("a", "m5.large", "ondemand"),
+		"b": newNode("b", "m5.large", "ondemand"),
+		"c": newNode("c", "c5.large", "ondemand"),
+		"d": newNode("d", "m5.large", "spot"),
+		"e": newNode("e", "m6i.large", "ondemand"),
+	}
+
+	m.repriceNodes()
+
+	tests := []struct {
+		node     string
+		wantType string
+		want     float64
+		source   string
+	}{
+		// reservations are allocated in name order
+		{"a", "reserved", 0.06, "commitment"},
+		{"b", "ondemand", 0.1 * 1.1, "fake+multiplier"},
+		// the plan discounts the overridden price, its multiplier replaces the on-demand one
+		{"c", "savingsplan", 0.07 * 0.75 * 0.8, "override+multiplier"},
+		// no spot price, priced on-demand and not covered by commitments
+		{"d", "spot", 0.1 * 1.1, "fake+multiplier"},
+		// price not loaded, the reservation is not allocated to it
+		{"e", "ondemand", 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.node, func(t *testing.T) {
+			cost := m.Nodes[tt.node].Cost
+			if cost.Type != tt.wantType || !almostEqual(cost.Total, tt.want) || cost.Source != tt.source {
+				t.Errorf("got %+v, want %s cost %v from %s", cost, tt.wantType, tt.want, tt.source)
+			}
+		})
+	}
+
+	// the reserved cost is split like every other price
+	reserved := m.Nodes["a"].Cost
+	if total := reserved.VCpu*2 + reserved.Memory*8; !almostEqual(total, 0.06) {
+		t.Errorf("got reserved vCPU and memory costs adding up to %v, want 0.06", total)
+	}
+	// the savings plan discounts every resource
+	if sp := m.Nodes["c"].Cost; !almostEqual(sp.VCpu, c5.OnDemandCost.VCpu*0.6/1.1) || !almostEqual(sp.Memory, c5.OnDemandCost.Memory*0.6/1.1) {
+		t.Errorf("got savings plan costs %+v, want 60%% of the on-demand ones before their multiplier", sp)
+	}
+}
@@ -0,0 +1,50 @@
+package exporter
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// compute refreshes pod usage, recomputes the costs and replaces the snapshot served by Collect
+func (m *Metrics) compute(ctx context.Context) {
+	start := time.Now()
+
+	ch := make(chan prometheus.Metric, 256)
+	done := make(chan struct{})
+	snapshot := make([]prometheus.Metric, 0, len(m.snapshot))
+	go func() {
+		for metric := range ch {
+			snapshot = append(snapshot, metric)
+		}
+		close(done)
+	}()
+
+	m.computeCosts(ctx, ch)
+	close(ch)
+	<-done
+
+	m.snapshotMtx.Lock()
+	m.snapshot = snapshot
+	m.snapshotMtx.Unlock()
+
+	m.computeDuration.Observe(time.Since(start).Seconds())
+	m.lastCompute.SetToCurrentTime()
+	log.Debugf("Computed %d metrics in %s", len(snapshot), time.Since(start))
+}
+
+func (m *Metrics) computeLoop(ctx context.Context) {
+	ticker := time.NewTicker(m.computeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.compute(ctx)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+// Config holds the settings that can be set in the configuration file, the file only needs
+// the settings that differ from the command line flags
+type Config struct {
+	ListenAddress string `json:"listenAddress"`
+	MetricsPath   string `json:"metricsPath"`
+	LogLevel      string `json:"logLevel"`
+
+	PodLabels            []string `json:"podLabels"`
+	NodeLabels           []string `json:"nodeLabels"`
+	NamespaceLabels      []string `json:"namespaceLabels"`
+	NamespaceAnnotations []string `json:"namespaceAnnotations"`
+
+	// Region of the cluster, defaults to the AWS_REGION environment variable
+	Region         string         `json:"region"`
+	PricingFilters PricingFilters `json:"pricingFilters"`
+
+	IdleAllocation         string   `json:"idleAllocation"`
+	ControlPlaneSupport    string   `json:"controlPlaneSupport"`
+	ControlPlaneAllocation string   `json:"controlPlaneAllocation"`
+	PricingRefreshInterval Duration `json:"pricingRefreshInterval"`
+	ComputeInterval        Duration `json:"computeInterval"`
+	AccountingInterval     Duration `json:"accountingInterval"`
+}
+
+// Duration is a time.Duration written as a string in the configuration file, e.g. 30s or 1h
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string like 30s or 1h: %w", err)
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	d.Duration = duration
+	return nil
+}
+
+// LoadConfig reads the configuration file at path, the settings it does not set keep their value in base
+func LoadConfig(path string, base Config) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := base.clone()
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, fmt.Errorf("could not parse config %s: %w", path, err)
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// Validate checks the configuration is usable
+func (c *Config) Validate() error {
+	if c.ListenAddress == "" {
+		return fmt.Errorf("listen address must not be empty")
+	}
+
+	if _, err := log.ParseLevel(c.LogLevel); err != nil {
+		return err
+	}
+
+	if err := ValidateIdleAllocation(c.IdleAllocation); err != nil {
+		return err
+	}
+
+	if err := ValidateControlPlaneSupport(c.ControlPlaneSupport); err != nil {
+		return err
+	}
+
+	if err := ValidateControlPlaneAllocation(c.ControlPlaneAllocation); err != nil {
+		return err
+	}
+
+	// a label that cannot be exposed would make every scrape fail, also after a reload
+	if err := ValidateLabels(c.PodLabels, c.NodeLabels, c.NamespaceLabels, c.NamespaceAnnotations); err != nil {
+		return err
+	}
+
+	for name, d := range map[string]Duration{
+		"pricing refresh interval": c.PricingRefreshInterval,
+		"compute interval":         c.ComputeInterval,
+		"accounting interval":      c.AccountingInterval,
+	} {
+		if d.Duration < 0 {
+			return fmt.Errorf("%s must not be negative, got %s", name, d)
+		}
+	}
+
+	return nil
+}
+
+// clone returns a deep copy of c, decoding into the copy must not change the slices and maps of c
+func (c Config) clone() *Config {
+	clone := c
+	clone.PodLabels = append([]string(nil), c.PodLabels...)
+	clone.NodeLabels = append([]string(nil), c.NodeLabels...)
+	clone.NamespaceLabels = append([]string(nil), c.NamespaceLabels...)
+	clone.NamespaceAnnotations = append([]string(nil), c.NamespaceAnnotations...)
+	clone.PricingFilters = PricingFilters{
+		EC2: mergeFilters(map[string]string{}, c.PricingFilters.EC2),
+		EKS: mergeFilters(map[string]string{}, c.PricingFilters.EKS),
+	}
+
+	return &clone
+}
+
+// restartRequired returns the settings that changed between old and c that are only read at startup
+func (c *Config) restartRequired(old *Config) []string {
+	changed := []string{}
+	if c.ListenAddress != old.ListenAddress {
+		changed = append(changed, "listenAddress")
+	}
+	if c.MetricsPath != old.MetricsPath {
+		changed = append(changed, "metricsPath")
+	}
+	if c.Region != old.Region {
+		changed = append(changed, "region")
+	}
+	if !reflect.DeepEqual(c.PricingFilters, old.PricingFilters) {
+		changed = append(changed, "pricingFilters")
+	}
+	if c.PricingRefreshInterval != old.PricingRefreshInterval {
+		changed = append(changed, "pricingRefreshInterval")
+	}
+	if c.ComputeInterval != old.ComputeInterval {
+		changed = append(changed, "computeInterval")
+	}
+	if c.AccountingInterval != old.AccountingInterval {
+		changed = append(changed, "accountingInterval")
+	}
+
+	return changed
+}
+
+// ApplyConfig applies the settings that can be changed without a restart: log level, idle and control plane allocation and
+// the exposed labels and annotations, which are re-applied to the pods, nodes and namespaces already known
+func (m *Metrics) ApplyConfig(c *Config) {
+	if level, err := log.ParseLevel(c.LogLevel); err == nil {
+		log.SetLevel(level)
+	}
+
+	m.podsMtx.Lock()
+	defer m.podsMtx.Unlock()
+	m.nodesMtx.Lock()
+	defer m.nodesMtx.Unlock()
+	m.namespacesMtx.Lock()
+	defer m.namespacesMtx.Unlock()
+	m.settingsMtx.Lock()
+	defer m.settingsMtx.Unlock()
+
+	m.idleAllocation = c.IdleAllocation
+	m.controlPlaneSupport = c.ControlPlaneSupport
+	m.controlPlaneAllocation = c.ControlPlaneAllocation
+	m.addPodLabels = c.PodLabels
+	m.addNodeLabels = c.NodeLabels
+	m.addNamespaceLabels = c.NamespaceLabels
+	m.addNamespaceAnnotations = c.NamespaceAnnotations
+
+	pods := m.informers.Core().V1().Pods().Lister()
+	for _, pod := range m.Pods {
+		if obj, err := pods.Pods(pod.Namespace).Get(pod.Name); err == nil {
+			pod.Labels = exposedLabels(m.addPodLabels, obj.ObjectMeta.Labels)
+		}
+	}
+
+	nodes := m.informers.Core().V1().Nodes().Lister()
+	for _, node := range m.Nodes {
+		if obj, err := nodes.Get(node.Name); err == nil {
+			node.Labels = exposedLabels(m.addNodeLabels, obj.ObjectMeta.Labels)
+		}
+	}
+
+	namespaces := m.informers.Core().V1().Namespaces().Lister()
+	for _, ns := range m.Namespaces {
+		if obj, err := namespaces.Get(ns.Name); err == nil {
+			ns.Labels = exposedLabels(m.addNamespaceLabels, obj.ObjectMeta.Labels)
+			ns.Annotations = exposedLabels(m.addNamespaceAnnotations, obj.ObjectMeta.Annotations)
+		}
+	}
+}
+
+// WatchConfig reloads the configuration file at path whenever it changes and applies it, current is the
+// configuration in use. The directory is watched since ConfigMap mounts replace the file through a symlink,
+// only the events of the file itself and of that symlink trigger a reload.
+func (m *Metrics) WatchConfig(ctx context.Context, path string, base Config, current *Config) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.WithError(err).Warn("Config watcher failed")
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !isConfigEvent(event, path) {
+					continue
+				}
+
+				c, err := LoadConfig(path, base)
+				if err != nil {
+					if !os.IsNotExist(err) {
+						log.WithError(err).Error("Failed to reload config, keeping current config")
+					}
+					continue
+				}
+				if reflect.DeepEqual(c, current) {
+					continue
+				}
+
+				if changed := c.restartRequired(current); len(changed) > 0 {
+					log.Warnf("Config settings %v changed, they are only applied after a restart", changed)
+				}
+
+				log.Infof("Reloading config from %s", path)
+				m.ApplyConfig(c)
+				current = c
+			}
+		}
+	}()
+
+	return nil
+}
+
+// configMapDataDir is the symlink a ConfigMap mount swaps to publish a new version of its files
+const configMapDataDir = "..data"
+
+// isConfigEvent reports whether event may have changed the configuration file at path
+func isConfigEvent(event fsnotify.Event, path string) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+
+	name := filepath.Base(event.Name)
+	return name == filepath.Base(path) || name == configMapDataDir
+}
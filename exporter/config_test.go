@@ -0,0 +1,72 @@
+package exporter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestIsConfigEvent(t *testing.T) {
+	path := "/etc/eks-cost-exporter/config.yaml"
+
+	tests := []struct {
+		name  string
+		event fsnotify.Event
+		want  bool
+	}{
+		{"file written", fsnotify.Event{Name: "/etc/eks-cost-exporter/config.yaml", Op: fsnotify.Write}, true},
+		{"file replaced", fsnotify.Event{Name: "/etc/eks-cost-exporter/config.yaml", Op: fsnotify.Create}, true},
+		{"configmap symlink swapped", fsnotify.Event{Name: "/etc/eks-cost-exporter/..data", Op: fsnotify.Create}, true},
+		{"configmap version directory", fsnotify.Event{Name: "/etc/eks-cost-exporter/..2024_01_01_00_00_00.000000000", Op: fsnotify.Create}, false},
+		{"configmap temporary symlink", fsnotify.Event{Name: "/etc/eks-cost-exporter/..data_tmp", Op: fsnotify.Rename}, false},
+		{"other file", fsnotify.Event{Name: "/etc/eks-cost-exporter/commitments.yaml", Op: fsnotify.Write}, false},
+		{"file chmod", fsnotify.Event{Name: "/etc/eks-cost-exporter/config.yaml", Op: fsnotify.Chmod}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isConfigEvent(tt.event, path); got != tt.want {
+				t.Errorf("isConfigEvent(%s) = %v, want %v", tt.event, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	base := Config{
+		ListenAddress:          ":8080",
+		LogLevel:               "info",
+		PodLabels:              []string{"app"},
+		IdleAllocation:         IdleAllocationNone,
+		ControlPlaneSupport:    ControlPlaneSupportAuto,
+		ControlPlaneAllocation: ControlPlaneAllocationNone,
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"labels", "podLabels: [app.kubernetes.io/name, cost-center]\nnamespaceAnnotations: [owner]\n", false},
+		{"label colliding with a metric label", "podLabels: [node]\n", true},
+		{"labels with the same name", "nodeLabels: [team.name, team/name]\n", true},
+		{"unknown setting", "podLabel: [app]\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := LoadConfig(path, base)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
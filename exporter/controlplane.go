@@ -0,0 +1,193 @@
+package exporter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ControlPlaneSupportAuto selects the support tier from the Kubernetes version of the cluster
+	ControlPlaneSupportAuto = "auto"
+	// ControlPlaneSupportStandard is the control plane price of the Kubernetes versions in standard support
+	ControlPlaneSupportStandard = "standard"
+	// ControlPlaneSupportExtended is the control plane price of the Kubernetes versions in extended support
+	ControlPlaneSupportExtended = "extended"
+
+	// ControlPlaneAllocationNone keeps the control plane cost attributed to the cluster only
+	ControlPlaneAllocationNone = "none"
+	// ControlPlaneAllocationCompute distributes the control plane cost to the namespaces proportionally to their compute cost
+	ControlPlaneAllocationCompute = "compute"
+)
+
+// ControlPlanePrice is the hourly price of one EKS cluster
+type ControlPlanePrice struct {
+	Standard float64
+	Extended float64
+	Source   string
+}
+
+// eksStandardSupportEnd is when the standard support of each EKS Kubernetes version ends, older versions
+// are in extended support and newer ones in standard support
+// https://docs.aws.amazon.com/eks/latest/userguide/kubernetes-versions.html
+var eksStandardSupportEnd = map[string]string{
+	"1.23": "2024-10-11",
+	"1.24": "2025-01-31",
+	"1.25": "2025-05-01",
+	"1.26": "2025-06-11",
+	"1.27": "2025-07-24",
+	"1.28": "2025-11-26",
+	"1.29": "2026-03-23",
+	"1.30": "2026-07-23",
+	"1.31": "2026-11-26",
+	"1.32": "2027-03-23",
+	"1.33": "2027-07-29",
+}
+
+// ValidateControlPlaneSupport checks that support is one of the supported control plane support tiers
+func ValidateControlPlaneSupport(support string) error {
+	switch support {
+	case ControlPlaneSupportAuto, ControlPlaneSupportStandard, ControlPlaneSupportExtended:
+		return nil
+	}
+
+	return fmt.Errorf("unknown control plane support %q, must be %s, %s or %s", support,
+		ControlPlaneSupportAuto, ControlPlaneSupportStandard, ControlPlaneSupportExtended)
+}
+
+// versionSupport returns the support tier of a Kubernetes minor version, e.g. 1.29, at now
+func versionSupport(version string, now time.Time) string {
+	var major, minor int
+	if _, err := fmt.Sscanf(version, "%d.%d", &major, &minor); err != nil {
+		return ""
+	}
+
+	if end, ok := eksStandardSupportEnd[fmt.Sprintf("%d.%d", major, minor)]; ok {
+		// standard support lasts until the end of that day
+		t, _ := time.Parse("2006-01-02", end)
+		if now.Before(t.AddDate(0, 0, 1)) {
+			return ControlPlaneSupportStandard
+		}
+		return ControlPlaneSupportExtended
+	}
+
+	for v := range eksStandardSupportEnd {
+		var oldest int
+		fmt.Sscanf(v, "1.%d", &oldest)
+		if major == 1 && minor < oldest {
+			return ControlPlaneSupportExtended
+		}
+	}
+
+	return ControlPlaneSupportStandard
+}
+
+// refreshClusterVersion reads the Kubernetes version of the cluster to select the control plane support tier,
+// a configured tier that contradicts it is reported
+func (m *Metrics) refreshClusterVersion() {
+	info, err := m.kubernetes.Discovery().ServerVersion()
+	if err != nil {
+		log.WithError(err).Warn("Failed to read the cluster version, the control plane is priced at the configured support tier")
+		return
+	}
+
+	// EKS reports minor versions like 29+
+	version := info.Major + "." + strings.TrimSuffix(info.Minor, "+")
+	support := versionSupport(version, time.Now())
+
+	m.settingsMtx.RLock()
+	configured := m.controlPlaneSupport
+	m.settingsMtx.RUnlock()
+	if configured != ControlPlaneSupportAuto && support != "" && configured != support {
+		log.Warnf("Control plane support is configured as %s but Kubernetes %s is in %s support", configured, version, support)
+	}
+
+	m.instancesMtx.Lock()
+	m.clusterSupport = support
+	m.instancesMtx.Unlock()
+}
+
+// ValidateControlPlaneAllocation checks that mode is one of the supported control plane allocation modes
+func ValidateControlPlaneAllocation(mode string) error {
+	switch mode {
+	case ControlPlaneAllocationNone, ControlPlaneAllocationCompute:
+		return nil
+	}
+
+	return fmt.Errorf("unknown control plane allocation mode %q, must be %s or %s", mode, ControlPlaneAllocationNone, ControlPlaneAllocationCompute)
+}
+
+// controlPlanePricing returns the cluster prices of the AmazonEKS products, the usage types are
+// e.g. USE1-AmazonEKS-Hours:perCluster and USE1-AmazonEKS-Hours:extendedSupport
+func controlPlanePricing(products []Pricing) *ControlPlanePrice {
+	price := &ControlPlanePrice{}
+	for _, product := range products {
+		usageType := product.Product.Attributes["usagetype"]
+
+		if strings.HasSuffix(usageType, "AmazonEKS-Hours:perCluster") {
+			price.Standard, _ = firstTierPrice(product)
+		} else if strings.HasSuffix(usageType, "AmazonEKS-Hours:extendedSupport") {
+			price.Extended, _ = firstTierPrice(product)
+		}
+	}
+
+	return price
+}
+
+// setControlPlanePrice replaces the control plane price
+func (m *Metrics) setControlPlanePrice(price *ControlPlanePrice) {
+	m.instancesMtx.Lock()
+	defer m.instancesMtx.Unlock()
+
+	m.controlPlanePrice = price
+}
+
+// controlPlaneSupportTier returns the support tier the control plane is priced at, the one of the cluster
+// version when configured as auto
+func (m *Metrics) controlPlaneSupportTier(configured string) string {
+	if configured != ControlPlaneSupportAuto {
+		return configured
+	}
+
+	m.instancesMtx.RLock()
+	defer m.instancesMtx.RUnlock()
+	if m.clusterSupport == "" {
+		return ControlPlaneSupportStandard
+	}
+
+	return m.clusterSupport
+}
+
+// controlPlaneCost returns the hourly cost of the cluster control plane in the support tier
+func (m *Metrics) controlPlaneCost(support string) float64 {
+	m.instancesMtx.RLock()
+	defer m.instancesMtx.RUnlock()
+
+	if m.controlPlanePrice == nil {
+		return 0
+	}
+
+	if support == ControlPlaneSupportExtended {
+		return m.controlPlanePrice.Extended
+	}
+
+	return m.controlPlanePrice.Standard
+}
+
+// distributeControlPlaneCost splits the control plane cost between the namespaces proportionally to
+// the compute cost of their pods
+func distributeControlPlaneCost(cost float64, namespaces map[string]*namespaceCost) {
+	total := float64(0)
+	for _, ns := range namespaces {
+		total += ns.Total
+	}
+	if total == 0 {
+		return
+	}
+
+	for _, ns := range namespaces {
+		ns.ControlPlane = cost * ns.Total / total
+	}
+}
@@ -0,0 +1,86 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDistributeControlPlaneCost(t *testing.T) {
+	tests := []struct {
+		name       string
+		namespaces map[string]*namespaceCost
+		want       map[string]float64
+	}{
+		{
+			name:       "proportionally to the compute cost",
+			namespaces: map[string]*namespaceCost{"a": {Total: 0.3}, "b": {Total: 0.1}, "c": {}},
+			want:       map[string]float64{"a": 0.075, "b": 0.025, "c": 0},
+		},
+		{
+			name:       "without compute cost",
+			namespaces: map[string]*namespaceCost{"a": {}, "b": {}},
+			want:       map[string]float64{"a": 0, "b": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distributeControlPlaneCost(0.1, tt.namespaces)
+
+			for name, want := range tt.want {
+				if got := tt.namespaces[name].ControlPlane; !almostEqual(got, want) {
+					t.Errorf("%s: got %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestVersionSupport(t *testing.T) {
+	now := time.Date(2025, 12, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		version string
+		now     time.Time
+		want    string
+	}{
+		{"1.28", now, ControlPlaneSupportExtended},
+		{"1.29", now, ControlPlaneSupportStandard},
+		{"1.29", time.Date(2026, 3, 23, 23, 0, 0, 0, time.UTC), ControlPlaneSupportStandard},
+		{"1.29", time.Date(2026, 3, 24, 0, 0, 0, 0, time.UTC), ControlPlaneSupportExtended},
+		{"1.22", now, ControlPlaneSupportExtended},
+		{"1.40", now, ControlPlaneSupportStandard},
+		{"1.30+", now, ControlPlaneSupportStandard},
+		{"unknown", now, ""},
+	}
+
+	for _, tt := range tests {
+		if got := versionSupport(tt.version, tt.now); got != tt.want {
+			t.Errorf("versionSupport(%q, %s) = %q, want %q", tt.version, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestControlPlaneSupportTier(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured string
+		cluster    string
+		want       string
+	}{
+		{"configured", ControlPlaneSupportStandard, ControlPlaneSupportExtended, ControlPlaneSupportStandard},
+		{"auto", ControlPlaneSupportAuto, ControlPlaneSupportExtended, ControlPlaneSupportExtended},
+		{"auto with an unknown version", ControlPlaneSupportAuto, "", ControlPlaneSupportStandard},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMetrics(&fakePricingProvider{})
+			m.clusterSupport = tt.cluster
+
+			if got := m.controlPlaneSupportTier(tt.configured); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,15 +2,12 @@ package exporter
 
 import (
 	"context"
-	"encoding/json"
-	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
-	"github.com/aws/aws-sdk-go-v2/service/pricing"
-	pricingtypes "github.com/aws/aws-sdk-go-v2/service/pricing/types"
 )
 
 const (
@@ -24,151 +21,184 @@ const (
 	// CPU-cost = 7.2 memory-GB-cost
 
 	// https://engineering.empathy.co/cloud-finops-part-4-kubernetes-cost-report/
-	cpuMemRelation = 7.2
+	DefaultCpuMemRelation = 7.2
 )
 
-func (m *Metrics) GetInstances(ctx context.Context) {
+// GetInstances returns the EC2 instance types with their on-demand and spot costs for each priced operating system,
+// keyed by instanceKey
+func (m *Metrics) GetInstances(ctx context.Context) (map[string]*Instance, error) {
 	now := time.Now()
 	defer timeTrack(now, "Retrieving EC2 Instance Types")
 
-	m.getInstances(ctx)
-	m.GetOnDemandPricing(ctx)
-	m.GetSpotPricing(ctx)
-}
+	var instances map[string]*Instance
+	err := retry(ctx, "Retrieving instance types", func() (err error) {
+		instances, err = m.pricing.InstanceTypes(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
-func (m *Metrics) getInstances(ctx context.Context) {
-	ec2Svc := ec2.NewFromConfig(m.awsconfig)
-	pag := ec2.NewDescribeInstanceTypesPaginator(
-		ec2Svc,
-		&ec2.DescribeInstanceTypesInput{})
-	for pag.HasMorePages() {
-		instances, err := pag.NextPage(ctx)
+	result := make(map[string]*Instance, len(instances))
+	for _, operatingSystem := range m.pricedOperatingSystems() {
+		var onDemand map[string]float64
+		err = retry(ctx, "Retrieving "+operatingSystem+" on-demand pricing", func() (err error) {
+			onDemand, err = m.pricing.OnDemandPricing(ctx, operatingSystem)
+			return err
+		})
 		if err != nil {
-			panic(err.Error())
+			return nil, err
 		}
-		for _, instance := range instances.InstanceTypes {
-			m.Instances[string(instance.InstanceType)] = &Instance{
-				Memory:       aws.ToInt64(instance.MemoryInfo.SizeInMiB),
-				VCpu:         aws.ToInt32(instance.VCpuInfo.DefaultVCpus),
-				Type:         string(instance.InstanceType),
-				OnDemandCost: &Ec2Cost{},
-				SpotCost:     make(map[string]*Ec2Cost, 0),
+
+		var spot map[string]map[string]float64
+		err = retry(ctx, "Retrieving "+operatingSystem+" spot pricing", func() (err error) {
+			spot, err = m.pricing.SpotPricing(ctx, operatingSystem)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if operatingSystem == OSLinux {
+			// the license of other operating systems does not change how the hardware is split
+			m.setCpuMemRatios(instances, onDemand)
+			setGpuShares(instances, onDemand)
+		}
+
+		for instanceType, hardware := range instances {
+			if _, ok := onDemand[instanceType]; !ok && operatingSystem != OSLinux {
+				// e.g. Graviton instances can not run Windows
+				continue
 			}
+
+			instance := *hardware
+			instance.OS = operatingSystem
+			m.priceInstance(&instance, onDemand[instanceType], spot[instanceType])
+			result[instanceKey(instanceType, operatingSystem)] = &instance
 		}
 	}
-}
 
-func (m Metrics) getInstanceMemory(instance string) string {
-	return strconv.Itoa(int(m.Instances[instance].Memory))
+	return result, nil
 }
 
-func (m Metrics) getInstanceVCpu(instance string) string {
-	return strconv.Itoa(int(m.Instances[instance].VCpu))
+// priceInstance sets the on-demand and spot costs of an instance from its hourly prices
+func (m *Metrics) priceInstance(instance *Instance, onDemand float64, spot map[string]float64) {
+	instance.OnDemandPrice = onDemand
+	value, source := m.overrides.apply("ondemand", instance, onDemand, m.pricing.Name())
+	vcpu, memory, gpu := getNormalizedCost(value, instance)
+	instance.OnDemandCost = &Ec2Cost{Type: "ondemand", Total: value, VCpu: vcpu, Memory: memory, Gpu: gpu, Source: source}
+
+	instance.SpotCost = make(map[string]*Ec2Cost, len(spot))
+	for az, value := range spot {
+		value, source := m.overrides.apply("spot", instance, value, m.pricing.Name())
+
+		vcpu, memory, gpu := getNormalizedCost(value, instance)
+
+		instance.SpotCost[az] = &Ec2Cost{Type: "spot", Total: value, VCpu: vcpu, Memory: memory, Gpu: gpu, Source: source}
+	}
 }
 
-func (m Metrics) getNormalizedCost(value float64, instance string) (float64, float64) {
-	vcpu := m.Instances[instance].VCpu
-	memory := m.Instances[instance].Memory / 1024
+// getNormalizedCost splits the instance price into the cost of one vCPU, one GB of memory and one GPU
+func getNormalizedCost(value float64, instance *Instance) (float64, float64, float64) {
+	gpuCost := float64(0)
+	if instance.Gpu > 0 {
+		gpuCost = value * instance.GpuShare / float64(instance.Gpu)
+		value = value * (1 - instance.GpuShare)
+	}
 
-	memoryCost := value / (cpuMemRelation*float64(vcpu) + float64(memory))
-	vcpuCost := cpuMemRelation * memoryCost
+	vcpu := instance.VCpu
+	memory := instance.Memory / 1024
 
-	return vcpuCost, memoryCost
+	ratio := instance.CpuMemRatio
+	if ratio == 0 {
+		ratio = DefaultCpuMemRelation
+	}
+
+	memoryCost := value / (ratio*float64(vcpu) + float64(memory))
+	vcpuCost := ratio * memoryCost
+
+	return vcpuCost, memoryCost, gpuCost
 }
 
-func (m *Metrics) GetOnDemandPricing(ctx context.Context) {
-	config := m.awsconfig
-	config.Region = "us-east-1" // this service is only available in us-east-1
-
-	pricingSvc := pricing.NewFromConfig(config)
-
-	pag := pricing.NewGetProductsPaginator(
-		pricingSvc,
-		&pricing.GetProductsInput{
-			ServiceCode: aws.String("AmazonEC2"),
-			MaxResults:  aws.Int32(100),
-			Filters: []pricingtypes.Filter{
-				{
-					Field: aws.String("regionCode"),
-					Type:  pricingtypes.FilterTypeTermMatch,
-					Value: aws.String(os.Getenv("AWS_REGION")),
-				},
-				{
-					Field: aws.String("capacitystatus"),
-					Type:  pricingtypes.FilterTypeTermMatch,
-					Value: aws.String("Used"),
-				},
-				{
-					Field: aws.String("tenancy"),
-					Type:  pricingtypes.FilterTypeTermMatch,
-					Value: aws.String("Shared"),
-				},
-				{
-					Field: aws.String("preInstalledSw"),
-					Type:  pricingtypes.FilterTypeTermMatch,
-					Value: aws.String("NA"),
-				},
-				{
-					Field: aws.String("operatingSystem"),
-					Type:  pricingtypes.FilterTypeTermMatch,
-					Value: aws.String("Linux"),
-				},
-			},
-		},
-	)
+func (p *AWSPricingProvider) InstanceTypes(ctx context.Context) (map[string]*Instance, error) {
+	ec2Svc := ec2.NewFromConfig(p.config)
+	pag := ec2.NewDescribeInstanceTypesPaginator(
+		ec2Svc,
+		&ec2.DescribeInstanceTypesInput{})
 
+	result := make(map[string]*Instance, 0)
 	for pag.HasMorePages() {
-		pricelist, err := pag.NextPage(ctx)
-
+		instances, err := pag.NextPage(ctx)
 		if err != nil {
-			panic(err.Error())
+			return nil, err
 		}
+		for _, instance := range instances.InstanceTypes {
+			tmp := &Instance{
+				Memory: aws.ToInt64(instance.MemoryInfo.SizeInMiB),
+				VCpu:   aws.ToInt32(instance.VCpuInfo.DefaultVCpus),
+				Type:   string(instance.InstanceType),
+			}
 
-		for _, price := range pricelist.PriceList {
-			var tmp Pricing
-			json.Unmarshal([]byte(price), &tmp)
+			if instance.GpuInfo != nil {
+				for _, gpu := range instance.GpuInfo.Gpus {
+					tmp.Gpu += aws.ToInt32(gpu.Count)
+					tmp.GpuModel = strings.TrimSpace(aws.ToString(gpu.Manufacturer) + " " + aws.ToString(gpu.Name))
+				}
+			}
 
-			skuOnDemand := tmp.Product.Sku + "." + TermOnDemand
-			skuOnDemandPerHour := skuOnDemand + "." + TermPerHour
+			result[string(instance.InstanceType)] = tmp
+		}
+	}
 
-			value, _ := strconv.ParseFloat(tmp.Terms.OnDemand[skuOnDemand].PriceDimensions[skuOnDemandPerHour].PricePerUnit["USD"], 64)
+	return result, nil
+}
 
-			vcpu, memory := m.getNormalizedCost(value, tmp.Product.Attributes["instanceType"])
+func (p *AWSPricingProvider) OnDemandPricing(ctx context.Context, operatingSystem string) (map[string]float64, error) {
+	products, err := p.getProducts(ctx, "AmazonEC2", p.filters.ec2(p.config.Region, operatingSystem))
+	if err != nil {
+		return nil, err
+	}
 
-			m.Instances[tmp.Product.Attributes["instanceType"]].OnDemandCost.Type = "ondemand"
-			m.Instances[tmp.Product.Attributes["instanceType"]].OnDemandCost.Total = value
-			m.Instances[tmp.Product.Attributes["instanceType"]].OnDemandCost.VCpu = vcpu
-			m.Instances[tmp.Product.Attributes["instanceType"]].OnDemandCost.Memory = memory
+	return onDemandPricing(products), nil
+}
 
-		}
+func onDemandPricing(products []Pricing) map[string]float64 {
+	result := make(map[string]float64, 0)
+	for _, product := range products {
+		value, _ := onDemandPrice(product)
 
+		result[product.Product.Attributes["instanceType"]] = value
 	}
-}
 
-func (m *Metrics) GetSpotPricing(ctx context.Context) {
-	config := m.awsconfig
+	return result
+}
 
-	ec2Svc := ec2.NewFromConfig(config)
+func (p *AWSPricingProvider) SpotPricing(ctx context.Context, operatingSystem string) (map[string]map[string]float64, error) {
+	ec2Svc := ec2.NewFromConfig(p.config)
 
 	pag := ec2.NewDescribeSpotPriceHistoryPaginator(
 		ec2Svc,
 		&ec2.DescribeSpotPriceHistoryInput{
 			StartTime:           aws.Time(time.Now()),
-			ProductDescriptions: []string{"Linux/UNIX"},
+			ProductDescriptions: []string{operatingSystems[operatingSystem].Spot},
 		})
 
+	result := make(map[string]map[string]float64, 0)
 	for pag.HasMorePages() {
 		history, err := pag.NextPage(ctx)
 		if err != nil {
-			panic(err.Error())
+			return nil, err
 		}
 
 		for _, price := range history.SpotPriceHistory {
 			value, _ := strconv.ParseFloat(*price.SpotPrice, 64)
 
-			vcpu, memory := m.getNormalizedCost(value, string(price.InstanceType))
-
-			m.Instances[string(price.InstanceType)].SpotCost[aws.ToString(price.AvailabilityZone)] = &Ec2Cost{Type: "spot", Total: value, VCpu: vcpu, Memory: memory}
+			if _, ok := result[string(price.InstanceType)]; !ok {
+				result[string(price.InstanceType)] = make(map[string]float64, 0)
+			}
+			result[string(price.InstanceType)][aws.ToString(price.AvailabilityZone)] = value
 		}
 	}
+
+	return result, nil
 }
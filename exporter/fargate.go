@@ -2,75 +2,65 @@ package exporter
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"os"
-	"strconv"
 	"strings"
 	"time"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/pricing"
-	pricingtypes "github.com/aws/aws-sdk-go-v2/service/pricing/types"
 )
 
-func (m *Metrics) GetFargatePricing(ctx context.Context) {
-	now := time.Now()
-	defer timeTrack(now, "Retrieving Fargate pricing")
-
-	config := m.awsconfig
-	config.Region = "us-east-1" // this service is only available in us-east-1
-
-	pricingSvc := pricing.NewFromConfig(config)
+// EKSPrices are the prices of the AmazonEKS offer
+type EKSPrices struct {
+	// Fargate is the hourly price of one vCPU and one GB of memory on Fargate
+	Fargate *Ec2Cost
+	// ControlPlane is the hourly price of the cluster control plane
+	ControlPlane *ControlPlanePrice
+}
 
-	m.Instances["fargate"] = &Instance{Type: "fargate"}
+// GetEKSPricing returns the pseudo instance used by Fargate nodes, its cost is the price of one vCPU and one GB of memory,
+// and the price of the control plane
+func (m *Metrics) GetEKSPricing(ctx context.Context) (*Instance, *ControlPlanePrice, error) {
+	now := time.Now()
+	defer timeTrack(now, "Retrieving EKS pricing")
 
-	pag := pricing.NewGetProductsPaginator(
-		pricingSvc,
-		&pricing.GetProductsInput{
-			ServiceCode: aws.String("AmazonEKS"),
-			MaxResults:  aws.Int32(100),
-			Filters: []pricingtypes.Filter{
-				{
-					Field: aws.String("regionCode"),
-					Type:  pricingtypes.FilterTypeTermMatch,
-					Value: aws.String(os.Getenv("AWS_REGION")),
-				},
-				{
-					Field: aws.String("tenancy"),
-					Type:  pricingtypes.FilterTypeTermMatch,
-					Value: aws.String("Shared"),
-				},
-			},
-		},
-	)
+	var prices *EKSPrices
+	err := retry(ctx, "Retrieving EKS pricing", func() (err error) {
+		prices, err = m.pricing.EKSPricing(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
 
-	for pag.HasMorePages() {
-		pricelist, err := pag.NextPage(ctx)
+	cost := prices.Fargate
+	cost.VCpu, _ = m.overrides.apply("fargate", nil, cost.VCpu, m.pricing.Name())
+	cost.Memory, cost.Source = m.overrides.apply("fargate", nil, cost.Memory, m.pricing.Name())
 
-		if err != nil {
-			panic(err.Error())
-		}
+	// both tiers go through the same overrides, so they share their source
+	controlPlane := prices.ControlPlane
+	controlPlane.Standard, controlPlane.Source = m.overrides.apply("controlplane", nil, controlPlane.Standard, m.pricing.Name())
+	controlPlane.Extended, _ = m.overrides.apply("controlplane", nil, controlPlane.Extended, m.pricing.Name())
 
-		for _, price := range pricelist.PriceList {
-			var tmp Pricing
-			json.Unmarshal([]byte(price), &tmp)
+	return &Instance{Type: "fargate", OnDemandCost: cost}, controlPlane, nil
+}
 
-			skuOnDemand := fmt.Sprintf("%s.%s", tmp.Product.Sku, TermOnDemand)
-			skuOnDemandPerHour := fmt.Sprintf("%s.%s", skuOnDemand, TermPerHour)
+func (p *AWSPricingProvider) EKSPricing(ctx context.Context) (*EKSPrices, error) {
+	products, err := p.getProducts(ctx, "AmazonEKS", p.filters.eks(p.config.Region))
+	if err != nil {
+		return nil, err
+	}
 
-			value, _ := strconv.ParseFloat(tmp.Terms.OnDemand[skuOnDemand].PriceDimensions[skuOnDemandPerHour].PricePerUnit["USD"], 64)
+	return &EKSPrices{Fargate: fargatePricing(products), ControlPlane: controlPlanePricing(products)}, nil
+}
 
-			description := tmp.Terms.OnDemand[skuOnDemand].PriceDimensions[skuOnDemandPerHour].Description
+func fargatePricing(products []Pricing) *Ec2Cost {
+	cost := &Ec2Cost{Type: "fargate"}
+	for _, product := range products {
+		value, description := onDemandPrice(product)
 
-			if m.Instances["fargate"].OnDemandCost == nil {
-				m.Instances["fargate"].OnDemandCost = &Ec2Cost{Type: "fargate"}
-			}
-			if strings.Contains(description, "AWS Fargate - vCPU - ") {
-				m.Instances["fargate"].OnDemandCost.VCpu = value
-			} else if strings.Contains(description, "AWS Fargate - Memory - ") {
-				m.Instances["fargate"].OnDemandCost.Memory = value
-			}
+		if strings.Contains(description, "AWS Fargate - vCPU - ") {
+			cost.VCpu = value
+		} else if strings.Contains(description, "AWS Fargate - Memory - ") {
+			cost.Memory = value
 		}
 	}
+
+	return cost
 }
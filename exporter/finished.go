@@ -0,0 +1,100 @@
+package exporter
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// podTerminated reports if all the containers of the pod stopped and will not be restarted
+func podTerminated(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+}
+
+// runningHours returns for how long the pod was running, from its start until its containers
+// finished or, if they did not, until now
+func runningHours(pod *corev1.Pod, now time.Time) float64 {
+	if pod.Status.StartTime == nil {
+		return 0
+	}
+
+	end := now
+	var finished time.Time
+	terminated := len(pod.Status.ContainerStatuses) > 0
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Terminated == nil {
+			terminated = false
+			break
+		}
+		if status.State.Terminated.FinishedAt.Time.After(finished) {
+			finished = status.State.Terminated.FinishedAt.Time
+		}
+	}
+	if terminated && !finished.IsZero() {
+		end = finished
+	}
+
+	hours := end.Sub(pod.Status.StartTime.Time).Hours()
+	if hours < 0 {
+		return 0
+	}
+
+	return hours
+}
+
+// podSpentAccounted reports if the accounting loop integrated the cost of the pod into its spent counter
+func (m *Metrics) podSpentAccounted(key string) bool {
+	m.spentMtx.Lock()
+	defer m.spentMtx.Unlock()
+
+	_, ok := m.podSpent[key]
+	return ok
+}
+
+// podFinished accumulates the cost of a pod over its whole run into the finished counters of its
+// namespace and Job, each pod is accounted only once even if more updates arrive after it terminated
+func (m *Metrics) podFinished(obj *corev1.Pod) {
+	key := obj.ObjectMeta.Namespace + "/" + obj.ObjectMeta.Name
+
+	m.podsMtx.RLock()
+	pod := m.Pods[key]
+	_, accounted := m.finishedPods[obj.ObjectMeta.UID]
+	m.podsMtx.RUnlock()
+	if accounted {
+		return
+	}
+
+	if pod == nil {
+		if len(obj.Spec.NodeName) == 0 {
+			// never scheduled, so never billed
+			return
+		}
+
+		// the pod started and terminated between two updates, e.g. a short Job
+		pod = m.newPod(obj)
+		m.podsMtx.Lock()
+		m.nodesMtx.RLock()
+		m.updatePodCost(pod)
+		m.nodesMtx.RUnlock()
+		m.podsMtx.Unlock()
+	}
+
+	cost := pod.Cost * runningHours(obj, time.Now())
+	log.Debugf("Pod finished: %s [cost=%v]", key, cost)
+
+	m.podsMtx.Lock()
+	defer m.podsMtx.Unlock()
+	if _, ok := m.finishedPods[obj.ObjectMeta.UID]; ok {
+		return
+	}
+	m.finishedPods[obj.ObjectMeta.UID] = struct{}{}
+	delete(m.Pods, key)
+
+	m.spentMtx.Lock()
+	defer m.spentMtx.Unlock()
+	m.finishedNamespaces[pod.Namespace] += cost
+	if owner := controllerOf(pod.Owners); owner != nil && owner.Kind == "Job" {
+		m.finishedJobs[pod.Namespace+"/"+owner.Name] += cost
+	}
+}
@@ -0,0 +1,79 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func terminatedContainer(finished time.Time) corev1.ContainerStatus {
+	return corev1.ContainerStatus{State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{FinishedAt: metav1.NewTime(finished)}}}
+}
+
+func TestRunningHours(t *testing.T) {
+	now := time.Now()
+	started := metav1.NewTime(now.Add(-3 * time.Hour))
+
+	tests := []struct {
+		name   string
+		status corev1.PodStatus
+		want   float64
+	}{
+		{"not started", corev1.PodStatus{}, 0},
+		{"running", corev1.PodStatus{StartTime: &started, ContainerStatuses: []corev1.ContainerStatus{{}}}, 3},
+		{"terminated", corev1.PodStatus{StartTime: &started, ContainerStatuses: []corev1.ContainerStatus{
+			terminatedContainer(now.Add(-2 * time.Hour)),
+			terminatedContainer(now.Add(-1 * time.Hour)),
+		}}, 2},
+		{"partially terminated", corev1.PodStatus{StartTime: &started, ContainerStatuses: []corev1.ContainerStatus{
+			terminatedContainer(now.Add(-2 * time.Hour)),
+			{},
+		}}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runningHours(&corev1.Pod{Status: tt.status}, now)
+
+			if !almostEqual(got, tt.want) {
+				t.Errorf("got %v hours, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPodFinished(t *testing.T) {
+	now := time.Now()
+	started := metav1.NewTime(now.Add(-2 * time.Hour))
+	obj := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "backup-28000-x7k2p", UID: types.UID("uid")},
+		Spec:       corev1.PodSpec{NodeName: "node"},
+		Status: corev1.PodStatus{
+			Phase:             corev1.PodSucceeded,
+			StartTime:         &started,
+			ContainerStatuses: []corev1.ContainerStatus{terminatedContainer(now.Add(-time.Hour))},
+		},
+	}
+
+	m := newTestMetrics(&fakePricingProvider{})
+	m.loadAccountingState()
+	m.finishedPods = make(map[types.UID]struct{})
+	m.Pods = map[string]*Pod{"default/backup-28000-x7k2p": {Namespace: "default", Owners: controllerRef("Job", "backup-28000"), Cost: 0.1}}
+
+	// later updates of the terminated pod are not accounted again
+	m.podFinished(obj)
+	m.podFinished(obj)
+
+	if _, ok := m.Pods["default/backup-28000-x7k2p"]; ok {
+		t.Error("got the finished pod still tracked")
+	}
+	if got := m.finishedNamespaces["default"]; !almostEqual(got, 0.1) {
+		t.Errorf("got namespace finished cost %v, want 0.1", got)
+	}
+	if got := m.finishedJobs["default/backup-28000"]; !almostEqual(got, 0.1) {
+		t.Errorf("got job finished cost %v, want 0.1", got)
+	}
+}
@@ -0,0 +1,36 @@
+package exporter
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// gpuResource is the extended resource requested by pods running on NVIDIA GPUs
+	gpuResource = "nvidia.com/gpu"
+)
+
+// setGpuShares sets the fraction of the price of accelerated instances that pays for their GPUs.
+// vCPU and memory of accelerated instances are priced at the rates of the compute (c), general purpose (m)
+// and memory (r) optimized instances of the region, the remainder of the on-demand price is the GPU cost.
+func setGpuShares(instances map[string]*Instance, onDemand map[string]float64) {
+	vcpuCost, memoryCost, ok := fitCpuMemRates(instances, onDemand, func(string) bool { return true })
+	if !ok {
+		log.Warn("Could not derive vCPU and memory rates of the region, GPU cost will be included in vCPU and memory cost")
+		return
+	}
+
+	for instanceType, instance := range instances {
+		price := onDemand[instanceType]
+		if instance.Gpu == 0 || price <= 0 {
+			continue
+		}
+
+		cpuMemory := vcpuCost*float64(instance.VCpu) + memoryCost*float64(instance.Memory)/1024
+		if cpuMemory >= price {
+			log.Debugf("vCPU and memory of %s cost more than the instance, not splitting GPU cost", instanceType)
+			continue
+		}
+
+		instance.GpuShare = 1 - cpuMemory/price
+	}
+}
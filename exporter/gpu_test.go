@@ -0,0 +1,68 @@
+package exporter
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestSetGpuShares(t *testing.T) {
+	// c, m and r instances priced at 0.03 per vCPU and 0.005 per GB
+	instances := map[string]*Instance{
+		"c5.large":    {Type: "c5.large", VCpu: 2, Memory: 4096},
+		"m5.large":    {Type: "m5.large", VCpu: 2, Memory: 8192},
+		"r5.large":    {Type: "r5.large", VCpu: 2, Memory: 16384},
+		"t3.large":    {Type: "t3.large", VCpu: 2, Memory: 8192},
+		"g4dn.xlarge": {Type: "g4dn.xlarge", VCpu: 4, Memory: 16384, Gpu: 1},
+		"p3.2xlarge":  {Type: "p3.2xlarge", VCpu: 8, Memory: 62464, Gpu: 1},
+	}
+	onDemand := map[string]float64{
+		"c5.large": 0.08,
+		"m5.large": 0.1,
+		"r5.large": 0.14,
+		// burstable instances are not used to derive the rates
+		"t3.large":    1,
+		"g4dn.xlarge": 0.526,
+		// cheaper than its vCPUs and memory at the derived rates
+		"p3.2xlarge": 0.2,
+	}
+
+	setGpuShares(instances, onDemand)
+
+	if want := 1 - (4*0.03+16*0.005)/0.526; !almostEqual(instances["g4dn.xlarge"].GpuShare, want) {
+		t.Errorf("got GPU share %v of g4dn.xlarge, want %v", instances["g4dn.xlarge"].GpuShare, want)
+	}
+	for _, instanceType := range []string{"m5.large", "p3.2xlarge"} {
+		if share := instances[instanceType].GpuShare; share != 0 {
+			t.Errorf("got GPU share %v of %s, want 0", share, instanceType)
+		}
+	}
+}
+
+func TestGetNormalizedCostGpu(t *testing.T) {
+	instance := &Instance{VCpu: 4, Memory: 16384, Gpu: 2, GpuShare: 0.6, CpuMemRatio: 2}
+
+	vcpu, memory, gpu := getNormalizedCost(1, instance)
+
+	// the GPUs get their share of the price, vCPUs and memory split the rest
+	if !almostEqual(gpu, 0.3) {
+		t.Errorf("got GPU cost %v, want 0.3", gpu)
+	}
+	if want := 0.4 / (2*4 + 16); !almostEqual(memory, want) || !almostEqual(vcpu, 2*want) {
+		t.Errorf("got vCPU cost %v and memory cost %v, want %v and %v", vcpu, memory, 2*want, want)
+	}
+}
+
+func TestUpdatePodCostGpu(t *testing.T) {
+	node := &Node{Instance: &Instance{Type: "g4dn.xlarge"}, Cost: &Ec2Cost{Type: "ondemand", VCpu: 0.04, Memory: 0.005, Gpu: 0.5}}
+	resources := newPodResources("1", "1Gi")
+	resources.Gpu = resource.NewQuantity(2, resource.DecimalSI)
+	pod := &Pod{Node: node, Resources: resources, Usage: newPodResources("0", "0")}
+
+	newTestMetrics(&fakePricingProvider{}).updatePodCost(pod)
+
+	// GPUs are not shared, the pod pays for the ones it requests
+	if want := 0.04 + 0.005 + 2*0.5; !almostEqual(pod.GpuCost, 2*0.5) || !almostEqual(pod.Cost, want) {
+		t.Errorf("got GPU cost %v and cost %v, want %v and %v", pod.GpuCost, pod.Cost, 2*0.5, want)
+	}
+}
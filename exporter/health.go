@@ -0,0 +1,134 @@
+package exporter
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// pricingRetryInterval is how often pricing is retried while it was never loaded
+	pricingRetryInterval = time.Minute
+)
+
+// retryBackoff bounds the retries of the calls to the AWS and Kubernetes APIs
+var retryBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    5,
+	Cap:      30 * time.Second,
+}
+
+// HealthStatus is a snapshot of the state of the exporter data sources
+type HealthStatus struct {
+	// PricingLoaded is true once prices were loaded at least once
+	PricingLoaded bool `json:"pricingLoaded"`
+	// PricingLoadTime is when prices were last loaded, from the provider or the cache
+	PricingLoadTime time.Time `json:"pricingLoadTime"`
+	// PricingError is the error of the last pricing refresh, empty if it succeeded
+	PricingError string `json:"pricingError,omitempty"`
+	// PricingProvider and Region identify where prices come from
+	PricingProvider string `json:"pricingProvider"`
+	Region          string `json:"region"`
+	// InstanceTypes is the number of instance types priced, once per operating system
+	InstanceTypes int `json:"instanceTypes"`
+	// OperatingSystems are the operating systems prices are loaded for
+	OperatingSystems []string `json:"operatingSystems"`
+	// NodesSynced and PodsSynced report if the informers completed their initial list
+	NodesSynced bool `json:"nodesSynced"`
+	PodsSynced  bool `json:"podsSynced"`
+	// UsageSource is the configured pod usage source
+	UsageSource string `json:"usageSource"`
+	// UsageRefreshTime is when pod usage was last refreshed successfully
+	UsageRefreshTime time.Time `json:"usageRefreshTime"`
+	// UsageError is the error of the last pod usage refresh, empty if it succeeded
+	UsageError string `json:"usageError,omitempty"`
+}
+
+// Ready reports if the exporter has the data it needs to expose meaningful costs
+func (h HealthStatus) Ready() bool {
+	return h.PricingLoaded && h.NodesSynced && h.PodsSynced
+}
+
+// Health returns the current state of the exporter data sources
+func (m *Metrics) Health() HealthStatus {
+	m.healthMtx.RLock()
+	h := m.health
+	m.healthMtx.RUnlock()
+
+	h.PricingProvider = m.pricing.Name()
+	h.Region = m.pricing.Region()
+	if m.usage != nil {
+		h.UsageSource = m.usage.Name()
+	}
+
+	h.OperatingSystems = m.pricedOperatingSystems()
+
+	m.instancesMtx.RLock()
+	h.InstanceTypes = len(m.Instances)
+	m.instancesMtx.RUnlock()
+
+	// the pods lock is held during the whole computation, probes must not wait for it
+	h.NodesSynced = m.nodesCached.Load()
+	h.PodsSynced = m.podsCached.Load()
+
+	return h
+}
+
+// pricingLoaded reports if prices were loaded at least once
+func (m *Metrics) pricingLoaded() bool {
+	m.healthMtx.RLock()
+	defer m.healthMtx.RUnlock()
+
+	return m.health.PricingLoaded
+}
+
+func (m *Metrics) setPricingHealth(err error) {
+	m.healthMtx.Lock()
+	defer m.healthMtx.Unlock()
+
+	if err != nil {
+		m.health.PricingError = err.Error()
+		return
+	}
+
+	m.health.PricingLoaded = true
+	m.health.PricingLoadTime = time.Now()
+	m.health.PricingError = ""
+}
+
+func (m *Metrics) setUsageHealth(err error) {
+	m.healthMtx.Lock()
+	defer m.healthMtx.Unlock()
+
+	m.health.UsageError = ""
+	if err != nil {
+		m.health.UsageError = err.Error()
+		return
+	}
+
+	m.health.UsageRefreshTime = time.Now()
+}
+
+// retry calls fn with exponential backoff until it succeeds or the retries are exhausted, returning the last error
+func retry(ctx context.Context, name string, fn func() error) error {
+	var lastErr error
+	err := wait.ExponentialBackoffWithContext(ctx, retryBackoff, func() (bool, error) {
+		lastErr = fn()
+		if lastErr != nil {
+			log.WithError(lastErr).Warnf("%s failed", name)
+			return false, nil
+		}
+
+		return true, nil
+	})
+
+	if err != nil && lastErr != nil {
+		return lastErr
+	}
+
+	return err
+}
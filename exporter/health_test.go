@@ -0,0 +1,31 @@
+package exporter
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHealthReady(t *testing.T) {
+	m := newTestMetrics(&fakePricingProvider{})
+	if m.Health().Ready() {
+		t.Fatal("got ready before anything was loaded")
+	}
+
+	m.setPricingHealth(nil)
+	m.nodesCached.Store(true)
+	if m.Health().Ready() {
+		t.Fatal("got ready before pods were synced")
+	}
+
+	m.podsCached.Store(true)
+	if !m.Health().Ready() {
+		t.Fatal("got not ready after pricing was loaded and the informers synced")
+	}
+
+	// a failed refresh keeps the prices loaded before
+	m.setPricingHealth(errors.New("throttled"))
+	h := m.Health()
+	if !h.Ready() || h.PricingError != "throttled" {
+		t.Errorf("got ready %v with pricing error %q, want ready with the error reported", h.Ready(), h.PricingError)
+	}
+}
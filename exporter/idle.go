@@ -0,0 +1,116 @@
+package exporter
+
+import (
+	"fmt"
+)
+
+const (
+	// IdleAllocationNone keeps the idle cost attributed to the nodes only
+	IdleAllocationNone = "none"
+	// IdleAllocationRequests redistributes idle cost proportionally to the cost of the pod requests
+	IdleAllocationRequests = "requests"
+	// IdleAllocationUsage redistributes idle cost proportionally to the cost of the pod usage
+	IdleAllocationUsage = "usage"
+	// IdleAllocationMax redistributes idle cost proportionally to the pod cost, the max of requests and usage
+	IdleAllocationMax = "max"
+)
+
+// ValidateIdleAllocation checks that mode is one of the supported idle cost allocation modes
+func ValidateIdleAllocation(mode string) error {
+	switch mode {
+	case IdleAllocationNone, IdleAllocationRequests, IdleAllocationUsage, IdleAllocationMax:
+		return nil
+	}
+
+	return fmt.Errorf("unknown idle allocation mode %q, must be %s, %s, %s or %s", mode,
+		IdleAllocationNone, IdleAllocationRequests, IdleAllocationUsage, IdleAllocationMax)
+}
+
+// nodeCapacityCost returns the hourly cost of all the vCPUs, memory and GPUs of a node
+func nodeCapacityCost(node *Node) *Ec2Cost {
+	if node.Cost.Type == "fargate" {
+		// fargate node cost is already scaled to the provisioned capacity
+		return &Ec2Cost{VCpu: node.Cost.VCpu, Memory: node.Cost.Memory}
+	}
+
+	return &Ec2Cost{
+		VCpu:   node.Cost.VCpu * float64(node.Instance.VCpu),
+		Memory: node.Cost.Memory * float64(node.Instance.Memory) / 1024,
+		Gpu:    node.Cost.Gpu * float64(node.Instance.Gpu),
+	}
+}
+
+// updateIdleCost computes the cost of each node that is not attributed to any of its pods and
+// redistributes it to the pods according to the idle allocation mode, caller must hold the pods lock
+func (m *Metrics) updateIdleCost() {
+	pods := make(map[*Node][]*Pod)
+	for _, pod := range m.Pods {
+		if pod.Node == nil {
+			continue
+		}
+
+		pods[pod.Node] = append(pods[pod.Node], pod)
+	}
+
+	m.nodesMtx.Lock()
+	defer m.nodesMtx.Unlock()
+
+	for _, node := range m.Nodes {
+		if node.Cost == nil || node.Instance == nil {
+			node.IdleCost = nil
+			continue
+		}
+
+		capacity := nodeCapacityCost(node)
+		allocated := &Ec2Cost{}
+		for _, pod := range pods[node] {
+			allocated.VCpu += max(pod.VCpuCost, pod.VCpuRequestsCost)
+			allocated.Memory += max(pod.MemoryCost, pod.MemoryRequestsCost)
+			allocated.Gpu += pod.GpuCost
+		}
+
+		// pods using more than they requested can go over the node capacity
+		idle := &Ec2Cost{
+			Type:   node.Cost.Type,
+			VCpu:   max(0, capacity.VCpu-allocated.VCpu),
+			Memory: max(0, capacity.Memory-allocated.Memory),
+			Gpu:    max(0, capacity.Gpu-allocated.Gpu),
+		}
+		idle.Total = idle.VCpu + idle.Memory + idle.Gpu
+
+		node.IdleCost = idle
+
+		m.redistributeIdleCost(idle.Total, pods[node])
+	}
+}
+
+// redistributeIdleCost splits the idle cost of a node between its pods proportionally to their weight,
+// pods without weight get an equal share
+func (m *Metrics) redistributeIdleCost(idle float64, pods []*Pod) {
+	weights := make([]float64, len(pods))
+	sum := float64(0)
+	for i, pod := range pods {
+		switch m.idleAllocation {
+		case IdleAllocationRequests:
+			weights[i] = pod.VCpuRequestsCost + pod.MemoryRequestsCost + pod.GpuCost
+		case IdleAllocationUsage:
+			weights[i] = pod.VCpuCost + pod.MemoryCost + pod.GpuCost
+		case IdleAllocationMax:
+			weights[i] = pod.Cost
+		}
+		sum += weights[i]
+	}
+
+	for i, pod := range pods {
+		pod.TotalWithIdle = pod.Cost
+		if m.idleAllocation == IdleAllocationNone {
+			continue
+		}
+
+		if sum > 0 {
+			pod.TotalWithIdle += idle * weights[i] / sum
+		} else {
+			pod.TotalWithIdle += idle / float64(len(pods))
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package exporter
+
+import (
+	"testing"
+)
+
+func TestUpdateIdleCost(t *testing.T) {
+	// 2 vCPUs and 8 GB: 0.08 of vCPU and 0.04 of memory
+	node := &Node{
+		Name:     "node",
+		Instance: &Instance{Type: "m5.large", VCpu: 2, Memory: 8192},
+		Cost:     &Ec2Cost{Type: "ondemand", VCpu: 0.04, Memory: 0.005},
+	}
+
+	m := newTestMetrics(&fakePricingProvider{})
+	m.Nodes = map[string]*Node{"node": node, "unpriced": {Name: "unpriced"}}
+	m.Pods = map[string]*Pod{
+		// requests 0.04 + 0.01, uses more cpu than requested
+		"default/a": {Node: node, VCpuRequestsCost: 0.04, VCpuCost: 0.06, MemoryRequestsCost: 0.01, MemoryCost: 0.005, Cost: 0.07},
+		"default/b": {Node: node, VCpuRequestsCost: 0.01, MemoryRequestsCost: 0.01, Cost: 0.02},
+		"default/c": {Cost: 0.01},
+	}
+
+	m.updateIdleCost()
+
+	if !almostEqual(node.IdleCost.VCpu, 0.08-0.06-0.01) || !almostEqual(node.IdleCost.Memory, 0.04-0.01-0.01) {
+		t.Errorf("got idle cost %+v, want 0.01 of vCPU and 0.02 of memory", node.IdleCost)
+	}
+	if !almostEqual(node.IdleCost.Total, 0.03) {
+		t.Errorf("got idle total %v, want 0.03", node.IdleCost.Total)
+	}
+	if m.Nodes["unpriced"].IdleCost != nil {
+		t.Errorf("got idle cost %+v of an unpriced node, want none", m.Nodes["unpriced"].IdleCost)
+	}
+}
+
+func TestUpdateIdleCostOverCapacity(t *testing.T) {
+	node := &Node{
+		Name:     "node",
+		Instance: &Instance{Type: "m5.large", VCpu: 2, Memory: 8192},
+		Cost:     &Ec2Cost{Type: "ondemand", VCpu: 0.04, Memory: 0.005},
+	}
+
+	m := newTestMetrics(&fakePricingProvider{})
+	m.Nodes = map[string]*Node{"node": node}
+	m.Pods = map[string]*Pod{"default/a": {Node: node, VCpuCost: 0.1, MemoryRequestsCost: 0.04}}
+
+	m.updateIdleCost()
+
+	if node.IdleCost.Total != 0 {
+		t.Errorf("got idle cost %+v, want none", node.IdleCost)
+	}
+}
+
+func TestRedistributeIdleCost(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		pods []*Pod
+		want []float64
+	}{
+		{
+			name: "none",
+			mode: IdleAllocationNone,
+			pods: []*Pod{{Cost: 0.03}, {Cost: 0.01}},
+			want: []float64{0.03, 0.01},
+		},
+		{
+			name: "requests",
+			mode: IdleAllocationRequests,
+			pods: []*Pod{{Cost: 0.05, VCpuRequestsCost: 0.02, MemoryRequestsCost: 0.01}, {Cost: 0.01, VCpuRequestsCost: 0.01}},
+			want: []float64{0.05 + 0.06*3/4, 0.01 + 0.06/4},
+		},
+		{
+			name: "usage",
+			mode: IdleAllocationUsage,
+			pods: []*Pod{{Cost: 0.05, VCpuCost: 0.01, MemoryCost: 0.01}, {Cost: 0.01}},
+			want: []float64{0.05 + 0.06, 0.01},
+		},
+		{
+			name: "max",
+			mode: IdleAllocationMax,
+			pods: []*Pod{{Cost: 0.04}, {Cost: 0.02}},
+			want: []float64{0.04 + 0.04, 0.02 + 0.02},
+		},
+		{
+			name: "pods without weight get an equal share",
+			mode: IdleAllocationUsage,
+			pods: []*Pod{{Cost: 0.04}, {Cost: 0.02}},
+			want: []float64{0.04 + 0.03, 0.02 + 0.03},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMetrics(&fakePricingProvider{})
+			m.idleAllocation = tt.mode
+
+			m.redistributeIdleCost(0.06, tt.pods)
+
+			for i, pod := range tt.pods {
+				if !almostEqual(pod.TotalWithIdle, tt.want[i]) {
+					t.Errorf("pod %d: got %v, want %v", i, pod.TotalWithIdle, tt.want[i])
+				}
+			}
+		})
+	}
+}
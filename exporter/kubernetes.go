@@ -2,15 +2,15 @@ package exporter
 
 import (
 	"context"
+	"reflect"
 	"regexp"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/tools/cache"
 )
 
@@ -22,37 +22,33 @@ func (m *Metrics) GetPods(ctx context.Context) {
 	now := time.Now()
 	defer timeTrack(now, "Retrieving current pod list")
 
-	m.podsCached = false
-	watchlist := cache.NewListWatchFromClient(
-		m.kubernetes.CoreV1().RESTClient(),
-		"pods", metav1.NamespaceAll,
-		fields.Everything())
-
-	_, controller := cache.NewInformer(
-		watchlist,
-		&corev1.Pod{},
-		time.Second*0,
-		cache.ResourceEventHandlerFuncs{
-			AddFunc:    m.podCreated,
-			DeleteFunc: m.podRemoved,
-			UpdateFunc: m.podUpdated,
-		},
-	)
+	m.podsCached.Store(false)
+	informer := m.informers.Core().V1().Pods().Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    m.podCreated,
+		DeleteFunc: m.podRemoved,
+		UpdateFunc: m.podUpdated,
+	})
 
-	m.podsChan = make(chan struct{})
-	go controller.Run(m.podsChan)
+	m.informers.Start(ctx.Done())
+	m.podsCached.Store(waitForHandler(ctx, informer, &m.podsAdded))
+}
 
-	cached := cache.WaitForCacheSync(m.podsChan, controller.HasSynced)
-	m.podsMtx.Lock()
-	m.podsCached = cached
-	m.podsMtx.Unlock()
+// waitForHandler waits until the handler of a shared informer was notified of the whole initial list,
+// HasSynced only reports that the informer store is populated as handlers are notified asynchronously
+func waitForHandler(ctx context.Context, informer cache.SharedIndexInformer, added *int64) bool {
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return false
+	}
+
+	initial := int64(len(informer.GetStore().ListKeys()))
+	return cache.WaitForCacheSync(ctx.Done(), func() bool {
+		return atomic.LoadInt64(added) >= initial
+	})
 }
 
 func (m *Metrics) podRemoved(obj interface{}) {
-	m.podsMtx.RLock()
-	c := m.podsCached
-	m.podsMtx.RUnlock()
-	if !c {
+	if !m.podsCached.Load() {
 		return
 	}
 
@@ -63,18 +59,21 @@ func (m *Metrics) podRemoved(obj interface{}) {
 
 	log.Debugf("Pod removed: %s/%s", pod.ObjectMeta.Namespace, pod.ObjectMeta.Name)
 
-	if _, ok := m.Pods[pod.ObjectMeta.Namespace+"/"+pod.ObjectMeta.Name]; ok {
-		m.podsMtx.Lock()
-		delete(m.Pods, pod.ObjectMeta.Namespace+"/"+pod.ObjectMeta.Name)
-		m.podsMtx.Unlock()
+	// pods deleted while running are already accounted by the spent counters, unless they were
+	// deleted before the accounting loop ever integrated them
+	key := pod.ObjectMeta.Namespace + "/" + pod.ObjectMeta.Name
+	if podTerminated(pod) || (m.accountingInterval > 0 && !m.podSpentAccounted(key)) {
+		m.podFinished(pod)
 	}
+
+	m.podsMtx.Lock()
+	delete(m.Pods, key)
+	delete(m.finishedPods, pod.ObjectMeta.UID)
+	m.podsMtx.Unlock()
 }
 
 func (m *Metrics) podUpdated(oldObj, newObj interface{}) {
-	m.podsMtx.RLock()
-	c := m.podsCached
-	m.podsMtx.RUnlock()
-	if !c {
+	if !m.podsCached.Load() {
 		return
 	}
 
@@ -83,115 +82,191 @@ func (m *Metrics) podUpdated(oldObj, newObj interface{}) {
 		return
 	}
 
+	if podTerminated(newPod) {
+		m.podFinished(newPod)
+		return
+	}
+
 	if newPod.Status.Phase == "Pending" {
 		return
 	}
 
+	if len(newPod.Spec.NodeName) == 0 {
+		return
+	}
+
+	m.podsMtx.RLock()
+	pod := m.Pods[newPod.ObjectMeta.Namespace+"/"+newPod.ObjectMeta.Name]
+	m.podsMtx.RUnlock()
+	if pod == nil {
+		// pod changed from Pending to Running
+		m.podCreated(newObj)
+		return
+	}
+
+	oldPod, ok := oldObj.(*corev1.Pod)
+	if ok && !podChanged(oldPod, newPod) {
+		return
+	}
+
 	log.Debugf("Pod updated: %s/%s", newPod.ObjectMeta.Namespace, newPod.ObjectMeta.Name)
 
-	if len(newPod.Spec.NodeName) > 0 {
-		pod := m.Pods[newPod.ObjectMeta.Namespace+"/"+newPod.ObjectMeta.Name]
-		if pod == nil {
-			// pod changed from Pending to Running
-			m.podCreated(newObj)
-		} else {
-			pod.Node = m.Nodes[newPod.Spec.NodeName]
-			m.updatePodCost(pod)
+	tmp := m.newPod(newPod)
+
+	// usage is kept, it is refreshed by the next computation
+	m.podsMtx.Lock()
+	pod.Labels = tmp.Labels
+	pod.Owners = tmp.Owners
+	pod.Claims = tmp.Claims
+	pod.Resources = tmp.Resources
+	pod.Node = tmp.Node
+	m.nodesMtx.RLock()
+	m.updatePodCost(pod)
+	m.nodesMtx.RUnlock()
+	m.podsMtx.Unlock()
+}
+
+// podChanged reports if any of the fields used to compute the pod cost or its labels changed
+func podChanged(oldPod, newPod *corev1.Pod) bool {
+	if oldPod.Spec.NodeName != newPod.Spec.NodeName {
+		return true
+	}
+	if !reflect.DeepEqual(oldPod.ObjectMeta.Labels, newPod.ObjectMeta.Labels) {
+		return true
+	}
+	if !reflect.DeepEqual(oldPod.ObjectMeta.OwnerReferences, newPod.ObjectMeta.OwnerReferences) {
+		return true
+	}
+	if oldPod.ObjectMeta.Annotations["CapacityProvisioned"] != newPod.ObjectMeta.Annotations["CapacityProvisioned"] {
+		return true
+	}
+	if len(oldPod.Spec.Containers) != len(newPod.Spec.Containers) {
+		return true
+	}
+	for i := range newPod.Spec.Containers {
+		// requests can be changed by in-place pod resize
+		if !reflect.DeepEqual(oldPod.Spec.Containers[i].Resources, newPod.Spec.Containers[i].Resources) {
+			return true
 		}
-		return
 	}
+
+	return false
 }
 
 func (m *Metrics) podCreated(obj interface{}) {
 	// we actually want to be called when initially populating the cache
 	// in order to populate or internal structures
+	defer atomic.AddInt64(&m.podsAdded, 1)
 
 	pod, ok := obj.(*corev1.Pod)
 	if !ok {
 		return
 	}
 
+	if podTerminated(pod) {
+		c := m.podsCached.Load()
+		m.podsMtx.Lock()
+		if !c {
+			// terminated before the exporter started, it may have already been accounted
+			m.finishedPods[pod.ObjectMeta.UID] = struct{}{}
+		}
+		m.podsMtx.Unlock()
+
+		if c {
+			m.podFinished(pod)
+		}
+		return
+	}
+
 	if pod.Status.Phase == "Pending" {
 		return
 	}
 
 	log.Debugf("Pod created: %s/%s", pod.ObjectMeta.Namespace, pod.ObjectMeta.Name)
 
+	tmp := m.newPod(pod)
+
+	m.podsMtx.Lock()
+	m.Pods[pod.ObjectMeta.Namespace+"/"+pod.ObjectMeta.Name] = tmp
+	m.nodesMtx.RLock()
+	m.updatePodCost(tmp)
+	m.nodesMtx.RUnlock()
+	m.podsMtx.Unlock()
+}
+
+// newPod builds the internal representation of a pod scheduled on a node
+func (m *Metrics) newPod(pod *corev1.Pod) *Pod {
 	resources := m.mergeResources(pod.Spec.Containers)
-	if m.Nodes[pod.Spec.NodeName] != nil {
-		if m.Nodes[pod.Spec.NodeName].Instance.Type == "fargate" {
-			// fargate allocates more resources than requested and charges accordingly
-			// the allocation size is exposed as an annotation
-			// https://docs.aws.amazon.com/eks/latest/userguide/fargate-pod-configuration.html
-			annotation := pod.ObjectMeta.Annotations["CapacityProvisioned"]
-			r := fargateRe.FindStringSubmatch(annotation)
 
+	m.nodesMtx.RLock()
+	node := m.Nodes[pod.Spec.NodeName]
+	fargate := node != nil && node.Instance != nil && node.Instance.Type == "fargate"
+	m.nodesMtx.RUnlock()
+
+	if fargate {
+		// fargate allocates more resources than requested and charges accordingly
+		// the allocation size is exposed as an annotation
+		// https://docs.aws.amazon.com/eks/latest/userguide/fargate-pod-configuration.html
+		annotation := pod.ObjectMeta.Annotations["CapacityProvisioned"]
+		r := fargateRe.FindStringSubmatch(annotation)
+		if r == nil {
+			log.Warnf("Pod %s/%s does not have a valid CapacityProvisioned annotation, using requests: %q", pod.ObjectMeta.Namespace, pod.ObjectMeta.Name, annotation)
+		} else {
 			cpu, _ := strconv.ParseFloat(r[fargateRe.SubexpIndex("cpu")], 64)
 			memory, _ := strconv.ParseFloat(r[fargateRe.SubexpIndex("memory")], 64)
 
-			m.Nodes[pod.Spec.NodeName].Cost.VCpu = m.Instances["fargate"].OnDemandCost.VCpu * cpu
-			m.Nodes[pod.Spec.NodeName].Cost.Memory = m.Instances["fargate"].OnDemandCost.Memory * memory
-			m.Nodes[pod.Spec.NodeName].Cost.Total = m.Nodes[pod.Spec.NodeName].Cost.VCpu + m.Nodes[pod.Spec.NodeName].Cost.Memory
-
 			cpu = cpu * 1000                     // to millicore
-			memory = memory * 1024 * 1024 * 1024 // to GB
+			memory = memory * 1024 * 1024 * 1024 // to bytes
 			resources.Cpu.SetMilli(int64(cpu))
 			resources.Memory.Set(int64(memory))
-
 		}
+
+		// the fargate node is shared with the node handlers and the computation
+		m.nodesMtx.Lock()
+		node.Capacity = resources
+		m.priceNode(node)
+		m.nodesMtx.Unlock()
 	}
 
-	tmp := Pod{
+	return &Pod{
 		Name:      pod.ObjectMeta.Name,
 		Namespace: pod.ObjectMeta.Namespace,
 		Labels:    m.exposedPodLabels(pod.ObjectMeta.Labels),
+		Owners:    pod.ObjectMeta.OwnerReferences,
+		Claims:    podClaims(pod),
 		Resources: resources,
-		Node:      m.Nodes[pod.Spec.NodeName],
+		Node:      node,
 		Usage: &PodResources{
 			Cpu:    resource.NewQuantity(0, resource.DecimalSI),
 			Memory: resource.NewQuantity(0, resource.BinarySI),
 		},
 	}
-
-	m.podsMtx.Lock()
-	m.Pods[pod.ObjectMeta.Namespace+"/"+pod.ObjectMeta.Name] = &tmp
-	m.updatePodCost(&tmp)
-	m.podsMtx.Unlock()
 }
 
 func (m *Metrics) GetNodes(ctx context.Context) {
 	now := time.Now()
 	defer timeTrack(now, "Retrieving current node list")
 
-	m.nodesCached = false
-	watchlist := cache.NewListWatchFromClient(
-		m.kubernetes.CoreV1().RESTClient(),
-		"nodes", metav1.NamespaceAll,
-		fields.Everything())
-
-	_, controller := cache.NewInformer(
-		watchlist,
-		&corev1.Node{},
-		time.Second*0,
-		cache.ResourceEventHandlerFuncs{
-			AddFunc:    m.nodeCreated,
-			DeleteFunc: m.nodeRemoved,
-		},
-	)
+	m.nodesCached.Store(false)
+	informer := m.informers.Core().V1().Nodes().Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    m.nodeCreated,
+		DeleteFunc: m.nodeRemoved,
+		UpdateFunc: m.nodeUpdated,
+	})
 
-	m.nodesChan = make(chan struct{})
-	go controller.Run(m.nodesChan)
+	m.informers.Start(ctx.Done())
+	cached := waitForHandler(ctx, informer, &m.nodesAdded)
 
-	cached := cache.WaitForCacheSync(m.nodesChan, controller.HasSynced)
+	// the initial list is priced at once instead of on every node
 	m.nodesMtx.Lock()
-	m.nodesCached = cached
+	m.repriceNodes()
+	m.nodesCached.Store(cached)
 	m.nodesMtx.Unlock()
 }
 
 func (m *Metrics) nodeRemoved(obj interface{}) {
-	m.nodesMtx.RLock()
-	defer m.nodesMtx.RUnlock()
-	if !m.nodesCached {
+	if !m.nodesCached.Load() {
 		return
 	}
 
@@ -202,16 +277,20 @@ func (m *Metrics) nodeRemoved(obj interface{}) {
 
 	log.Debugf("Node removed: %s", node.ObjectMeta.Name)
 
+	m.nodesMtx.Lock()
+	defer m.nodesMtx.Unlock()
 	if _, ok := m.Nodes[node.ObjectMeta.Name]; ok {
-		m.nodesMtx.Lock()
 		delete(m.Nodes, node.ObjectMeta.Name)
-		m.nodesMtx.Unlock()
+		// released commitments can now cover other nodes
+		m.repriceNodes()
 	}
 }
 
 func (m *Metrics) nodeCreated(obj interface{}) {
 	// we actually want to be called when initially populating the cache
 	// in order to populate or internal structures
+	defer atomic.AddInt64(&m.nodesAdded, 1)
+
 	node, ok := obj.(*corev1.Node)
 	if !ok {
 		return
@@ -219,39 +298,149 @@ func (m *Metrics) nodeCreated(obj interface{}) {
 
 	log.Debugf("Node created: %s", node.ObjectMeta.Name)
 
+	tmp := m.newNode(node)
+
+	m.nodesMtx.Lock()
+	m.Nodes[node.ObjectMeta.Name] = tmp
+	if m.nodesCached.Load() {
+		m.repriceNodes()
+	}
+	m.nodesMtx.Unlock()
+}
+
+func (m *Metrics) nodeUpdated(oldObj, newObj interface{}) {
+	if !m.nodesCached.Load() {
+		return
+	}
+
+	oldNode, ok := oldObj.(*corev1.Node)
+	if !ok {
+		return
+	}
+	newNode, ok := newObj.(*corev1.Node)
+	if !ok {
+		return
+	}
+
+	// everything we know about a node comes from its labels, status updates are ignored
+	if reflect.DeepEqual(oldNode.ObjectMeta.Labels, newNode.ObjectMeta.Labels) {
+		return
+	}
+
+	log.Debugf("Node updated: %s", newNode.ObjectMeta.Name)
+
+	tmp := m.newNode(newNode)
+
+	m.nodesMtx.Lock()
+	defer m.nodesMtx.Unlock()
+
+	node, ok := m.Nodes[newNode.ObjectMeta.Name]
+	if !ok {
+		m.Nodes[newNode.ObjectMeta.Name] = tmp
+		m.repriceNodes()
+		return
+	}
+
+	// pods point to the node, so it is updated in place
+	node.Labels = tmp.Labels
+	node.AZ = tmp.AZ
+	node.Region = tmp.Region
+	node.Lifecycle = tmp.Lifecycle
+	node.OS = tmp.OS
+	if tmp.Instance == nil || node.Instance == nil || tmp.Instance.Type != node.Instance.Type {
+		node.Instance = tmp.Instance
+	}
+	// e.g. a node relabeled from on-demand to spot, or the commitments it is eligible for changed
+	m.repriceNodes()
+}
+
+// newNode builds the internal representation of a node from its labels
+func (m *Metrics) newNode(node *corev1.Node) *Node {
 	tmp := Node{
-		Name:   node.ObjectMeta.Name,
-		Labels: m.exposedNodeLabels(node.ObjectMeta.Labels),
-		AZ:     node.ObjectMeta.Labels["topology.kubernetes.io/zone"],
-		Region: node.ObjectMeta.Labels["topology.kubernetes.io/region"],
+		Name:      node.ObjectMeta.Name,
+		Labels:    m.exposedNodeLabels(node.ObjectMeta.Labels),
+		AZ:        node.ObjectMeta.Labels["topology.kubernetes.io/zone"],
+		Region:    node.ObjectMeta.Labels["topology.kubernetes.io/region"],
+		Lifecycle: "ondemand",
+		OS:        nodeOS(node),
 	}
 
 	if _, ok := node.ObjectMeta.Labels["node.kubernetes.io/instance-type"]; ok {
 		// EC2
-		tmp.Instance = m.Instances[node.ObjectMeta.Labels["node.kubernetes.io/instance-type"]]
+		tmp.Instance = &Instance{Type: node.ObjectMeta.Labels["node.kubernetes.io/instance-type"]}
 
 		if _, ok := node.ObjectMeta.Labels["karpenter.sh/capacity-type"]; ok && node.ObjectMeta.Labels["karpenter.sh/capacity-type"] == "spot" {
 			// Node managed by Karpenter and is Spot
-			tmp.Cost = tmp.Instance.SpotCost[tmp.AZ]
-		} else {
-			tmp.Cost = tmp.Instance.OnDemandCost
+			tmp.Lifecycle = "spot"
 		}
 	} else if _, ok := node.Labels["eks.amazonaws.com/compute-type"]; ok && node.Labels["eks.amazonaws.com/compute-type"] == "fargate" {
 		// Fargate
-		tmp.Instance = m.Instances["fargate"]
-		tmp.Cost = &Ec2Cost{Type: "fargate", VCpu: tmp.Instance.OnDemandCost.VCpu, Memory: tmp.Instance.OnDemandCost.Memory}
+		tmp.Instance = &Instance{Type: "fargate"}
+		tmp.Lifecycle = "fargate"
 	}
 
-	m.nodesMtx.Lock()
-	m.Nodes[node.ObjectMeta.Name] = &tmp
-	m.nodesMtx.Unlock()
+	return &tmp
+}
+
+// priceNode sets the node instance and cost from the current Instances map,
+// it is called again for every node whenever pricing is refreshed
+func (m *Metrics) priceNode(node *Node) {
+	if node.Instance == nil {
+		return
+	}
+
+	m.instancesMtx.RLock()
+	instance, ok := m.Instances[instanceKey(node.Instance.Type, node.OS)]
+	m.instancesMtx.RUnlock()
+	if !ok {
+		if m.requestOSPricing(node.OS) {
+			log.Infof("Loading %s pricing for node %s", node.OS, node.Name)
+		} else if m.pricingLoaded() {
+			log.Warnf("Price of %s for %s not found", node.Instance.Type, node.OS)
+		}
+		node.Instance = &Instance{Type: node.Instance.Type, OnDemandCost: &Ec2Cost{Type: node.Lifecycle}}
+		node.Cost = node.Instance.OnDemandCost
+		return
+	}
+	node.Instance = instance
+
+	switch node.Lifecycle {
+	case "spot":
+		node.Cost = instance.SpotCost[node.AZ]
+		if node.Cost == nil {
+			// e.g. offline pricing mode does not have spot prices, the node is still exposed as spot
+			key := instance.Type + "/" + node.AZ
+			if _, ok := m.missingSpotPrices[key]; !ok {
+				log.Warnf("Spot price of %s in %s not found, using on-demand price", instance.Type, node.AZ)
+				m.missingSpotPrices[key] = struct{}{}
+			}
+
+			cost := *instance.OnDemandCost
+			cost.Type = "spot"
+			node.Cost = &cost
+		}
+	case "fargate":
+		node.Cost = &Ec2Cost{Type: "fargate", VCpu: instance.OnDemandCost.VCpu, Memory: instance.OnDemandCost.Memory, Source: instance.OnDemandCost.Source}
+		if node.Capacity != nil {
+			// node cost is scaled to the provisioned capacity
+			cpu := float64(node.Capacity.Cpu.MilliValue()) / 1000
+			memory := float64(node.Capacity.Memory.Value()) / 1024 / 1024 / 1024
+
+			node.Cost.VCpu = instance.OnDemandCost.VCpu * cpu
+			node.Cost.Memory = instance.OnDemandCost.Memory * memory
+			node.Cost.Total = node.Cost.VCpu + node.Cost.Memory
+		}
+	default:
+		node.Cost = instance.OnDemandCost
+	}
 }
 
-func (m Metrics) mergeResources(containers []corev1.Container) *PodResources {
+func (m *Metrics) mergeResources(containers []corev1.Container) *PodResources {
 	//TODO: dont allocate if pod does not have resources configured
 	resources := PodResources{
 		Cpu:    resource.NewQuantity(0, resource.DecimalSI),
 		Memory: resource.NewQuantity(0, resource.BinarySI),
+		Gpu:    resource.NewQuantity(0, resource.DecimalSI),
 	}
 
 	for _, container := range containers {
@@ -262,44 +451,64 @@ func (m Metrics) mergeResources(containers []corev1.Container) *PodResources {
 			if memory, ok := container.Resources.Requests["memory"]; ok {
 				resources.Memory.Add(memory)
 			}
+			if gpu, ok := container.Resources.Requests[gpuResource]; ok {
+				resources.Gpu.Add(gpu)
+			}
 		}
 	}
 
 	return &resources
 }
 
-func (m *Metrics) GetUsageCost() {
-	podMetricsList, err := m.metrics.MetricsV1beta1().PodMetricses("").List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		panic(err.Error())
+// GetUsage reads the pod usage from the usage source, bounded by the compute interval so a slow source
+// does not delay the next computation
+func (m *Metrics) GetUsage(ctx context.Context) (map[string]*PodResources, error) {
+	timeout := m.computeInterval
+	if timeout <= 0 {
+		timeout = usageTimeout
 	}
 
-	log.Debugf("Refreshing pod usage and cost")
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-	// caller is already holding the lock
-	for _, pod := range podMetricsList.Items {
-		name := pod.GetName()
-		namespace := pod.GetNamespace()
+	return m.usage.PodUsage(ctx)
+}
 
-		me := m.Pods[namespace+"/"+name]
-		me.Usage.Cpu.Reset()
-		me.Usage.Memory.Reset()
+// updateUsageCost sets the usage of the pods and reprices them, caller must hold the pods lock
+func (m *Metrics) updateUsageCost(usage map[string]*PodResources) {
+	log.Debugf("Refreshing pod usage and cost")
 
-		for _, container := range pod.Containers {
-			me.Usage.Cpu.Add(container.Usage["cpu"])
-			me.Usage.Memory.Add(container.Usage["memory"])
+	now := time.Now()
+
+	m.nodesMtx.RLock()
+	defer m.nodesMtx.RUnlock()
+	for key, pod := range m.Pods {
+		// pods not reported by the usage source, e.g. on a node the source failed to read, keep their last
+		// known usage for a while, pods without a recent usage, e.g. just started, are charged for their requests
+		if resources, ok := usage[key]; ok {
+			pod.Usage.Cpu.Reset()
+			pod.Usage.Memory.Reset()
+			pod.Usage.Cpu.Add(*resources.Cpu)
+			pod.Usage.Memory.Add(*resources.Memory)
+			pod.UsageTime = now
+		} else if now.Sub(pod.UsageTime) > usageMaxAge {
+			pod.Usage.Cpu.Reset()
+			pod.Usage.Memory.Reset()
 		}
 
-		m.updatePodCost(me)
+		m.updatePodCost(pod)
 	}
 }
 
+// updatePodCost prices the pod from the current cost of its node, caller must hold the pods lock and the nodes lock
 func (m *Metrics) updatePodCost(pod *Pod) {
-	if pod.Node == nil {
+	if pod.Node == nil || pod.Node.Cost == nil {
 		pod.MemoryCost = float64(0)
 		pod.VCpuCost = float64(0)
 		pod.MemoryRequestsCost = float64(0)
 		pod.VCpuRequestsCost = float64(0)
+		pod.GpuCost = float64(0)
+		pod.Cost = float64(0)
 
 		return
 	}
@@ -308,7 +517,7 @@ func (m *Metrics) updatePodCost(pod *Pod) {
 	if pod.Node.Cost.Type == "fargate" {
 		// since fargate have a fixed price per VCpu/Memory we need to consider that instead of node cost
 		// node cost is already scaled to the actual cost instead of base price
-		nodeCost = m.Instances["fargate"].OnDemandCost
+		nodeCost = pod.Node.Instance.OnDemandCost
 	}
 
 	// convert bytes to GB
@@ -319,7 +528,10 @@ func (m *Metrics) updatePodCost(pod *Pod) {
 	pod.VCpuCost = float64(pod.Usage.Cpu.MilliValue()) / 1000 * nodeCost.VCpu
 	pod.VCpuRequestsCost = float64(pod.Resources.Cpu.MilliValue()) / 1000 * nodeCost.VCpu
 
-	pod.Cost = max(pod.MemoryCost, pod.MemoryRequestsCost) + max(pod.VCpuCost, pod.VCpuRequestsCost)
+	// GPUs are not shared between pods so requests are the actual usage
+	pod.GpuCost = float64(pod.Resources.Gpu.Value()) * nodeCost.Gpu
+
+	pod.Cost = max(pod.MemoryCost, pod.MemoryRequestsCost) + max(pod.VCpuCost, pod.VCpuRequestsCost) + pod.GpuCost
 }
 
 func max(a, b float64) float64 {
@@ -329,32 +541,16 @@ func max(a, b float64) float64 {
 	return b
 }
 
-func (m Metrics) exposedPodLabels(podLabels map[string]string) map[string]string {
-	if len(m.addPodLabels) == 0 {
-		return map[string]string{}
-	}
-
-	d := make(map[string]string, 0)
-	for _, addLabel := range m.addPodLabels {
-		if l, ok := podLabels[addLabel]; ok {
-			d[addLabel] = l
-		}
-	}
+func (m *Metrics) exposedPodLabels(podLabels map[string]string) map[string]string {
+	m.settingsMtx.RLock()
+	defer m.settingsMtx.RUnlock()
 
-	return d
+	return exposedLabels(m.addPodLabels, podLabels)
 }
 
-func (m Metrics) exposedNodeLabels(nodeLabels map[string]string) map[string]string {
-	if len(m.addNodeLabels) == 0 {
-		return map[string]string{}
-	}
-
-	d := make(map[string]string, 0)
-	for _, addLabel := range m.addNodeLabels {
-		if l, ok := nodeLabels[addLabel]; ok {
-			d[addLabel] = l
-		}
-	}
+func (m *Metrics) exposedNodeLabels(nodeLabels map[string]string) map[string]string {
+	m.settingsMtx.RLock()
+	defer m.settingsMtx.RUnlock()
 
-	return d
+	return exposedLabels(m.addNodeLabels, nodeLabels)
 }
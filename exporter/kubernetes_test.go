@@ -0,0 +1,194 @@
+package exporter
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newPodResources returns the resources of a pod, e.g. newPodResources("500m", "1Gi")
+func newPodResources(cpu, memory string) *PodResources {
+	return &PodResources{
+		Cpu:    resourcePtr(resource.MustParse(cpu)),
+		Memory: resourcePtr(resource.MustParse(memory)),
+		Gpu:    resource.NewQuantity(0, resource.DecimalSI),
+	}
+}
+
+func resourcePtr(q resource.Quantity) *resource.Quantity {
+	return &q
+}
+
+func TestUpdatePodCost(t *testing.T) {
+	// 1 vCPU costs 0.04 and 1 GB of memory 0.005
+	ec2 := &Node{
+		Instance: &Instance{Type: "m5.large"},
+		Cost:     &Ec2Cost{Type: "ondemand", VCpu: 0.04, Memory: 0.005},
+	}
+	fargate := &Node{
+		Instance: &Instance{Type: "fargate", OnDemandCost: &Ec2Cost{Type: "fargate", VCpu: 0.04, Memory: 0.004}},
+		// scaled to the provisioned capacity, which must not be used to price the pod
+		Cost: &Ec2Cost{Type: "fargate", VCpu: 0.08, Memory: 0.016},
+	}
+
+	tests := []struct {
+		name      string
+		node      *Node
+		resources *PodResources
+		usage     *PodResources
+		want      float64
+	}{
+		{"usage below requests", ec2, newPodResources("1", "2Gi"), newPodResources("500m", "1Gi"), 0.04 + 2*0.005},
+		{"usage above requests", ec2, newPodResources("500m", "1Gi"), newPodResources("2", "4Gi"), 2*0.04 + 4*0.005},
+		{"cpu above and memory below requests", ec2, newPodResources("500m", "4Gi"), newPodResources("1", "1Gi"), 0.04 + 4*0.005},
+		{"fargate", fargate, newPodResources("1", "2Gi"), newPodResources("0", "0"), 0.04 + 2*0.004},
+		{"unscheduled", nil, newPodResources("1", "2Gi"), newPodResources("1", "2Gi"), 0},
+	}
+
+	m := newTestMetrics(&fakePricingProvider{})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &Pod{Node: tt.node, Resources: tt.resources, Usage: tt.usage}
+
+			m.updatePodCost(pod)
+
+			if !almostEqual(pod.Cost, tt.want) {
+				t.Errorf("got cost %v, want %v", pod.Cost, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriceNode(t *testing.T) {
+	linux := &Instance{
+		Type:         "m5.large",
+		OS:           OSLinux,
+		OnDemandCost: &Ec2Cost{Type: "ondemand", Total: 0.096},
+		SpotCost:     map[string]*Ec2Cost{"us-east-1a": {Type: "spot", Total: 0.035}},
+	}
+	fargate := &Instance{Type: "fargate", OnDemandCost: &Ec2Cost{Type: "fargate", VCpu: 0.04, Memory: 0.004}}
+
+	tests := []struct {
+		name      string
+		node      *Node
+		want      float64
+		wantType  string
+		requestOS bool
+	}{
+		{"on-demand", &Node{Lifecycle: "ondemand", OS: OSLinux, Instance: &Instance{Type: "m5.large"}}, 0.096, "ondemand", false},
+		{"spot", &Node{Lifecycle: "spot", OS: OSLinux, AZ: "us-east-1a", Instance: &Instance{Type: "m5.large"}}, 0.035, "spot", false},
+		// e.g. offline pricing, priced on-demand but still exposed as spot
+		{"spot without price in the zone", &Node{Lifecycle: "spot", OS: OSLinux, AZ: "us-east-1b", Instance: &Instance{Type: "m5.large"}}, 0.096, "spot", false},
+		{"fargate", &Node{Lifecycle: "fargate", OS: OSLinux, Instance: &Instance{Type: "fargate"}, Capacity: newPodResources("2", "4Gi")}, 2*0.04 + 4*0.004, "fargate", false},
+		{"operating system not priced", &Node{Lifecycle: "ondemand", OS: OSWindows, Instance: &Instance{Type: "m5.large"}}, 0, "ondemand", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMetrics(&fakePricingProvider{})
+			m.Instances = map[string]*Instance{"m5.large": linux, "fargate": fargate}
+
+			m.priceNode(tt.node)
+
+			if !almostEqual(tt.node.Cost.Total, tt.want) || tt.node.Cost.Type != tt.wantType {
+				t.Errorf("got %s cost %v, want %s cost %v", tt.node.Cost.Type, tt.node.Cost.Total, tt.wantType, tt.want)
+			}
+
+			_, requested := m.operatingSystems[tt.node.OS]
+			if !requested || (len(m.pricingRefresh) > 0) != tt.requestOS {
+				t.Errorf("got %s requested %v and refresh pending %v, want %v", tt.node.OS, requested, len(m.pricingRefresh) > 0, tt.requestOS)
+			}
+		})
+	}
+}
+
+func TestPriceNodeMissingSpotPrice(t *testing.T) {
+	m := newTestMetrics(&fakePricingProvider{})
+	m.Instances = map[string]*Instance{"m5.large": {Type: "m5.large", OS: OSLinux, OnDemandCost: &Ec2Cost{Type: "ondemand", Total: 0.096}}}
+
+	// every reprice of every node of the same type and zone warns only once
+	for i := 0; i < 3; i++ {
+		m.priceNode(&Node{Lifecycle: "spot", OS: OSLinux, AZ: "us-east-1a", Instance: &Instance{Type: "m5.large"}})
+	}
+	m.priceNode(&Node{Lifecycle: "spot", OS: OSLinux, AZ: "us-east-1b", Instance: &Instance{Type: "m5.large"}})
+
+	if len(m.missingSpotPrices) != 2 {
+		t.Errorf("got missing spot prices %v, want m5.large in us-east-1a and us-east-1b", m.missingSpotPrices)
+	}
+	if m.Instances["m5.large"].OnDemandCost.Type != "ondemand" {
+		t.Error("got the on-demand cost of the instance changed")
+	}
+}
+
+func TestNodeUpdated(t *testing.T) {
+	m5 := &Instance{
+		Type:         "m5.large",
+		OS:           OSLinux,
+		OnDemandCost: &Ec2Cost{Type: "ondemand", Total: 0.096},
+		SpotCost:     map[string]*Ec2Cost{"us-east-1a": {Type: "spot", Total: 0.035}},
+	}
+	labels := map[string]string{
+		"node.kubernetes.io/instance-type": "m5.large",
+		"topology.kubernetes.io/zone":      "us-east-1a",
+	}
+	oldNode := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node", Labels: labels}}
+
+	m := newTestMetrics(&fakePricingProvider{})
+	m.Instances = map[string]*Instance{"m5.large": m5}
+	m.commitments = &Commitments{}
+	m.overrides = &PricingOverrides{}
+	m.nodesCached.Store(true)
+
+	node := m.newNode(oldNode)
+	m.priceNode(node)
+	m.Nodes["node"] = node
+	pod := &Pod{Node: node}
+
+	// relabeled by Karpenter as spot
+	newNode := oldNode.DeepCopy()
+	newNode.ObjectMeta.Labels["karpenter.sh/capacity-type"] = "spot"
+	m.nodeUpdated(oldNode, newNode)
+
+	if pod.Node != m.Nodes["node"] {
+		t.Fatal("got the node replaced, want it updated in place")
+	}
+	if node.Lifecycle != "spot" || !almostEqual(node.Cost.Total, 0.035) {
+		t.Errorf("got %s node costing %v, want spot costing 0.035", node.Lifecycle, node.Cost.Total)
+	}
+}
+
+func TestPodChanged(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Labels: map[string]string{"app": "web"}},
+		Spec: corev1.PodSpec{NodeName: "node", Containers: []corev1.Container{{
+			Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}},
+		}}},
+	}
+
+	tests := []struct {
+		name   string
+		change func(pod *corev1.Pod)
+		want   bool
+	}{
+		{"status only", func(pod *corev1.Pod) { pod.Status.Phase = corev1.PodRunning }, false},
+		{"labels", func(pod *corev1.Pod) { pod.ObjectMeta.Labels["app"] = "api" }, true},
+		{"node", func(pod *corev1.Pod) { pod.Spec.NodeName = "other" }, true},
+		{"resized", func(pod *corev1.Pod) {
+			pod.Spec.Containers[0].Resources.Requests[corev1.ResourceCPU] = resource.MustParse("200m")
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newPod := pod.DeepCopy()
+			tt.change(newPod)
+
+			if got := podChanged(pod, newPod); got != tt.want {
+				t.Errorf("got changed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
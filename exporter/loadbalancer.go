@@ -0,0 +1,250 @@
+package exporter
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// LoadBalancerClassic is a Classic Load Balancer, the default of Services of type LoadBalancer
+	LoadBalancerClassic = "clb"
+	// LoadBalancerNetwork is a Network Load Balancer
+	LoadBalancerNetwork = "nlb"
+	// LoadBalancerApplication is an Application Load Balancer, provisioned for Ingresses
+	LoadBalancerApplication = "alb"
+
+	albIngressController = "ingress.k8s.aws/alb"
+	nlbServiceClass      = "service.k8s.aws/nlb"
+
+	defaultIngressClassAnnotation = "ingressclass.kubernetes.io/is-default-class"
+)
+
+// loadBalancerFamilies maps the product family of each load balancer type in the AWSELB price list
+var loadBalancerFamilies = map[string]string{
+	LoadBalancerClassic:     "Load Balancer",
+	LoadBalancerNetwork:     "Load Balancer-Network",
+	LoadBalancerApplication: "Load Balancer-Application",
+}
+
+// LoadBalancer is an ELB provisioned for a Service or an Ingress
+type LoadBalancer struct {
+	Namespace string
+	Name      string
+	Type      string
+	// Cost is the fixed hourly cost, capacity units are not accounted
+	Cost float64
+}
+
+// elbProductFilters selects the products of a load balancer family of a region in the AWSELB price list,
+// the Local Zones and Outposts of the region are priced differently
+func elbProductFilters(region string, family string) map[string]string {
+	return map[string]string{
+		"regionCode":    region,
+		"locationType":  "AWS Region",
+		"productFamily": family,
+	}
+}
+
+// GetLoadBalancerPricing returns the fixed hourly price of each load balancer type
+func (m *Metrics) GetLoadBalancerPricing(ctx context.Context) (map[string]float64, error) {
+	now := time.Now()
+	defer timeTrack(now, "Retrieving load balancer pricing")
+
+	var prices map[string]float64
+	err := retry(ctx, "Retrieving load balancer pricing", func() (err error) {
+		prices, err = m.pricing.LoadBalancerPricing(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for lbType, price := range prices {
+		prices[lbType], _ = m.overrides.apply("loadbalancer", nil, price, m.pricing.Name())
+	}
+
+	return prices, nil
+}
+
+func (p *AWSPricingProvider) LoadBalancerPricing(ctx context.Context) (map[string]float64, error) {
+	prices := make(map[string]float64, len(loadBalancerFamilies))
+	for lbType, family := range loadBalancerFamilies {
+		products, err := p.getProducts(ctx, "AWSELB", elbProductFilters(p.config.Region, family))
+		if err != nil {
+			return nil, err
+		}
+
+		if price, ok := loadBalancerPrice(products); ok {
+			prices[lbType] = price
+		}
+	}
+
+	return prices, nil
+}
+
+// loadBalancerPrice returns the hourly price of the products of a load balancer family,
+// the capacity unit products (e.g. LCUUsage) are ignored
+func loadBalancerPrice(products []Pricing) (float64, bool) {
+	for _, product := range products {
+		if !strings.HasSuffix(product.Product.Attributes["usagetype"], "LoadBalancerUsage") {
+			continue
+		}
+
+		value, _ := firstTierPrice(product)
+		return value, true
+	}
+
+	return 0, false
+}
+
+// setLoadBalancerPrices replaces the load balancer prices
+func (m *Metrics) setLoadBalancerPrices(prices map[string]float64) {
+	m.instancesMtx.Lock()
+	defer m.instancesMtx.Unlock()
+
+	m.loadBalancerPrices = prices
+}
+
+// GetLoadBalancers caches the Services, Ingresses and IngressClasses
+func (m *Metrics) GetLoadBalancers(ctx context.Context) {
+	now := time.Now()
+	defer timeTrack(now, "Retrieving current Service and Ingress list")
+
+	svcInformer := m.informers.Core().V1().Services()
+	ingInformer := m.informers.Networking().V1().Ingresses()
+	classInformer := m.informers.Networking().V1().IngressClasses()
+	m.services = svcInformer.Lister()
+	m.ingresses = ingInformer.Lister()
+	m.ingressClasses = classInformer.Lister()
+
+	m.informers.Start(ctx.Done())
+	cache.WaitForCacheSync(ctx.Done(), svcInformer.Informer().HasSynced, ingInformer.Informer().HasSynced, classInformer.Informer().HasSynced)
+}
+
+// serviceLoadBalancerType classifies the load balancer of a Service the same way the in-tree
+// cloud provider and the AWS Load Balancer Controller do, classic is the in-tree default. Services of
+// another load balancer class are served by other implementations, e.g. MetalLB, and have no type
+func serviceLoadBalancerType(svc *corev1.Service) string {
+	if svc.Spec.LoadBalancerClass != nil {
+		if *svc.Spec.LoadBalancerClass == nlbServiceClass {
+			return LoadBalancerNetwork
+		}
+		return ""
+	}
+
+	switch svc.ObjectMeta.Annotations["service.beta.kubernetes.io/aws-load-balancer-type"] {
+	case "nlb", "nlb-ip", "external":
+		return LoadBalancerNetwork
+	}
+
+	return LoadBalancerClassic
+}
+
+// ingressIsALB reports if the ingress is served by the AWS Load Balancer Controller, ingresses
+// without a class are served by the default IngressClass
+func (m *Metrics) ingressIsALB(ing *networkingv1.Ingress) bool {
+	class := ing.ObjectMeta.Annotations["kubernetes.io/ingress.class"]
+	if ing.Spec.IngressClassName != nil {
+		class = *ing.Spec.IngressClassName
+	}
+	if class == "" {
+		class = m.defaultIngressClass()
+	}
+	if class == "" {
+		return false
+	}
+
+	if ingressClass, err := m.ingressClasses.Get(class); err == nil {
+		return ingressClass.Spec.Controller == albIngressController
+	}
+
+	// the legacy annotation does not need an IngressClass
+	return class == LoadBalancerApplication
+}
+
+// defaultIngressClass returns the name of the IngressClass marked as default, empty if there is none
+func (m *Metrics) defaultIngressClass() string {
+	classes, err := m.ingressClasses.List(labels.Everything())
+	if err != nil {
+		log.WithError(err).Warn("Failed to list IngressClasses")
+		return ""
+	}
+
+	for _, class := range classes {
+		if class.ObjectMeta.Annotations[defaultIngressClassAnnotation] == "true" {
+			return class.ObjectMeta.Name
+		}
+	}
+
+	return ""
+}
+
+// loadBalancers returns the provisioned load balancers with their hourly cost, ingresses of
+// the same group share one ALB so its cost is split between them
+func (m *Metrics) loadBalancers() []*LoadBalancer {
+	m.instancesMtx.RLock()
+	prices := m.loadBalancerPrices
+	m.instancesMtx.RUnlock()
+
+	lbs := []*LoadBalancer{}
+
+	services, err := m.services.List(labels.Everything())
+	if err != nil {
+		log.WithError(err).Warn("Failed to list Services")
+	}
+	for _, svc := range services {
+		if svc.Spec.Type != corev1.ServiceTypeLoadBalancer || len(svc.Status.LoadBalancer.Ingress) == 0 {
+			continue
+		}
+
+		lbType := serviceLoadBalancerType(svc)
+		if lbType == "" {
+			continue
+		}
+		lbs = append(lbs, &LoadBalancer{
+			Namespace: svc.ObjectMeta.Namespace,
+			Name:      svc.ObjectMeta.Name,
+			Type:      lbType,
+			Cost:      prices[lbType],
+		})
+	}
+
+	ingresses, err := m.ingresses.List(labels.Everything())
+	if err != nil {
+		log.WithError(err).Warn("Failed to list Ingresses")
+	}
+	groups := make(map[string][]*LoadBalancer)
+	for _, ing := range ingresses {
+		if len(ing.Status.LoadBalancer.Ingress) == 0 || !m.ingressIsALB(ing) {
+			continue
+		}
+
+		lb := &LoadBalancer{
+			Namespace: ing.ObjectMeta.Namespace,
+			Name:      ing.ObjectMeta.Name,
+			Type:      LoadBalancerApplication,
+		}
+		lbs = append(lbs, lb)
+
+		// ingresses without group get their own ALB
+		group := ing.ObjectMeta.Namespace + "/" + ing.ObjectMeta.Name
+		if name, ok := ing.ObjectMeta.Annotations["alb.ingress.kubernetes.io/group.name"]; ok {
+			group = "group/" + name
+		}
+		groups[group] = append(groups[group], lb)
+	}
+	for _, members := range groups {
+		for _, lb := range members {
+			lb.Cost = prices[LoadBalancerApplication] / float64(len(members))
+		}
+	}
+
+	return lbs
+}
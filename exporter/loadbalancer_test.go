@@ -0,0 +1,126 @@
+package exporter
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestLoadBalancers(t *testing.T) {
+	provisioned := corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{Hostname: "lb.elb.amazonaws.com"}}}
+	alb := "alb"
+	nginx := "nginx"
+	nlb := nlbServiceClass
+	metallb := "metallb.universe.tf/metallb"
+
+	services := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, svc := range []*corev1.Service{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "classic"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+			Status:     corev1.ServiceStatus{LoadBalancer: provisioned},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "nlb", Annotations: map[string]string{"service.beta.kubernetes.io/aws-load-balancer-type": "external"}},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+			Status:     corev1.ServiceStatus{LoadBalancer: provisioned},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: "nlb-class"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, LoadBalancerClass: &nlb},
+			Status:     corev1.ServiceStatus{LoadBalancer: provisioned},
+		},
+		{
+			// not an AWS load balancer, also with the annotation of the AWS Load Balancer Controller
+			ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: "metallb", Annotations: map[string]string{"service.beta.kubernetes.io/aws-load-balancer-type": "external"}},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, LoadBalancerClass: &metallb},
+			Status:     corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "192.168.1.240"}}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: "pending"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: "cluster-ip"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP},
+		},
+	} {
+		services.Add(svc)
+	}
+
+	classes := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	classes.Add(&networkingv1.IngressClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "alb", Annotations: map[string]string{defaultIngressClassAnnotation: "true"}},
+		Spec:       networkingv1.IngressClassSpec{Controller: albIngressController},
+	})
+	classes.Add(&networkingv1.IngressClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx"},
+		Spec:       networkingv1.IngressClassSpec{Controller: "k8s.io/ingress-nginx"},
+	})
+
+	ingressStatus := networkingv1.IngressStatus{LoadBalancer: networkingv1.IngressLoadBalancerStatus{
+		Ingress: []networkingv1.IngressLoadBalancerIngress{{Hostname: "alb.elb.amazonaws.com"}},
+	}}
+	group := map[string]string{"alb.ingress.kubernetes.io/group.name": "shared"}
+
+	ingresses := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, ing := range []*networkingv1.Ingress{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "grouped", Annotations: group},
+			Spec:       networkingv1.IngressSpec{IngressClassName: &alb},
+			Status:     ingressStatus,
+		},
+		{
+			// served by the default IngressClass
+			ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: "grouped", Annotations: group},
+			Status:     ingressStatus,
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: "own"},
+			Spec:       networkingv1.IngressSpec{IngressClassName: &alb},
+			Status:     ingressStatus,
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: "nginx"},
+			Spec:       networkingv1.IngressSpec{IngressClassName: &nginx},
+			Status:     ingressStatus,
+		},
+	} {
+		ingresses.Add(ing)
+	}
+
+	m := newTestMetrics(&fakePricingProvider{})
+	m.services = corelisters.NewServiceLister(services)
+	m.ingresses = networkinglisters.NewIngressLister(ingresses)
+	m.ingressClasses = networkinglisters.NewIngressClassLister(classes)
+	m.loadBalancerPrices = map[string]float64{
+		LoadBalancerClassic:     0.025,
+		LoadBalancerNetwork:     0.0225,
+		LoadBalancerApplication: 0.0225,
+	}
+
+	want := map[string]LoadBalancer{
+		"a/classic":   {Type: LoadBalancerClassic, Cost: 0.025},
+		"a/nlb":       {Type: LoadBalancerNetwork, Cost: 0.0225},
+		"b/nlb-class": {Type: LoadBalancerNetwork, Cost: 0.0225},
+		"a/grouped":   {Type: LoadBalancerApplication, Cost: 0.0225 / 2},
+		"b/grouped":   {Type: LoadBalancerApplication, Cost: 0.0225 / 2},
+		"b/own":       {Type: LoadBalancerApplication, Cost: 0.0225},
+	}
+
+	lbs := m.loadBalancers()
+	if len(lbs) != len(want) {
+		t.Fatalf("got %d load balancers, want %d", len(lbs), len(want))
+	}
+	for _, lb := range lbs {
+		key := lb.Namespace + "/" + lb.Name
+		if w, ok := want[key]; !ok || lb.Type != w.Type || !almostEqual(lb.Cost, w.Cost) {
+			t.Errorf("%s: got %s at %v, want %s at %v", key, lb.Type, lb.Cost, w.Type, w.Cost)
+		}
+	}
+}
@@ -2,72 +2,217 @@ package exporter
 
 import (
 	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
+var (
+	// invalidLabelRe matches the characters not allowed in label names
+	invalidLabelRe = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+	// labelNameRe matches a valid label name, names starting with __ are reserved
+	labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	// podMetricLabels, nodeMetricLabels and namespaceMetricLabels are the labels of the pod, node and namespace
+	// metrics, the exposed labels and annotations are added after them
+	podMetricLabels       = []string{"pod", "namespace", "node", "type", "lifecycle"}
+	nodeMetricLabels      = []string{"node", "region", "az", "type", "lifecycle"}
+	namespaceMetricLabels = []string{"namespace"}
+)
+
 const (
 	namespace = "eks_cost"
 )
 
-func NewMetrics(ctx context.Context, registry *prometheus.Registry, addPodLabels []string, addNodeLabels []string) (*Metrics, error) {
+func NewMetrics(ctx context.Context, registry *prometheus.Registry, provider PricingProvider, opts Options) (*Metrics, error) {
 	m := Metrics{}
 	m.Instances = make(map[string]*Instance)
+	m.operatingSystems = map[string]struct{}{OSLinux: {}}
+	m.pricingRefresh = make(chan struct{}, 1)
 	m.Pods = make(map[string]*Pod)
+	m.finishedPods = make(map[types.UID]struct{})
 	m.Nodes = make(map[string]*Node)
-	m.addPodLabels = addPodLabels
-	m.addNodeLabels = addNodeLabels
+	m.missingSpotPrices = make(map[string]struct{})
+	m.Namespaces = make(map[string]*Namespace)
+	m.addPodLabels = opts.PodLabels
+	m.addNodeLabels = opts.NodeLabels
+	m.addNamespaceLabels = opts.NamespaceLabels
+	m.addNamespaceAnnotations = opts.NamespaceAnnotations
+	m.pricing = provider
+	m.pricingRefreshInterval = opts.PricingRefreshInterval
+	m.pricingCacheFile = opts.PricingCacheFile
+	m.pricingCacheTTL = opts.PricingCacheTTL
+	m.commitments = opts.Commitments
+	m.overrides = opts.Overrides
+	m.cpuMemRatioStrategy = opts.CpuMemRatioStrategy
+	m.cpuMemRatio = opts.CpuMemRatio
+	m.cpuMemRatioOverrides = opts.CpuMemRatioOverrides
+	m.accountingInterval = opts.AccountingInterval
+	m.stateFile = opts.StateFile
+	m.idleAllocation = opts.IdleAllocation
+	m.usageSource = opts.UsageSource
+	m.computeInterval = opts.ComputeInterval
+	m.prometheusURL = opts.PrometheusURL
+	m.usageWindow = opts.UsageWindow
+	m.controlPlaneSupport = opts.ControlPlaneSupport
+	m.controlPlaneAllocation = opts.ControlPlaneAllocation
+	if m.idleAllocation == "" {
+		m.idleAllocation = IdleAllocationNone
+	}
+	if m.controlPlaneSupport == "" {
+		m.controlPlaneSupport = ControlPlaneSupportAuto
+	}
+	if m.controlPlaneAllocation == "" {
+		m.controlPlaneAllocation = ControlPlaneAllocationNone
+	}
+
+	m.pricingLastRefresh = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pricing_last_refresh_timestamp_seconds",
+		Help:      "Timestamp of the last successful pricing refresh.",
+	})
+	m.pricingRefreshErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pricing_refresh_errors_total",
+		Help:      "Number of failed pricing refreshes.",
+	})
+	m.scrapeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scrape_errors_total",
+		Help:      "Number of errors while refreshing data during a cost computation, by data source.",
+	}, []string{"source"})
+	m.lastCompute = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_compute_timestamp_seconds",
+		Help:      "Timestamp of the last cost computation.",
+	})
+	m.computeDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "compute_duration_seconds",
+		Help:      "Time taken to refresh pod usage and compute the costs.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	})
 
-	m.init(ctx)
+	if err := m.init(ctx); err != nil {
+		return nil, err
+	}
 
 	registry.MustRegister(&m)
+	registry.MustRegister(m.pricingLastRefresh, m.pricingRefreshErrors, m.scrapeErrors, m.lastCompute, m.computeDuration)
 	registry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
 	registry.MustRegister(collectors.NewGoCollector())
 
 	return &m, nil
 }
 
-func (m *Metrics) init(ctx context.Context) {
+func (m *Metrics) init(ctx context.Context) error {
 	config := ctrl.GetConfigOrDie()
 	m.config = config
 
 	clientset := kubernetes.NewForConfigOrDie(config)
 	m.kubernetes = clientset
+	m.refreshClusterVersion()
 
 	metricsClientset := metricsv.NewForConfigOrDie(config)
 	m.metrics = metricsClientset
 
-	cfg, err := newAWSConfig(ctx)
+	m.informers = informers.NewSharedInformerFactory(clientset, 0)
+
+	usage, err := m.newUsageSource(m.usageSource)
 	if err != nil {
-		panic(err.Error())
+		return err
 	}
-	m.awsconfig = cfg
+	m.usage = usage
 
-	m.GetInstances(ctx)
+	// serve cached prices right away and refresh them in the background once they expire
+	next, ok := m.loadPricingCache()
+	if !ok {
+		if err := m.RefreshPricing(ctx); err != nil {
+			// nodes are priced as soon as the pricing is available
+			log.WithError(err).Error("Failed to load pricing, costs will be zero until it succeeds")
+		}
 
-	m.GetFargatePricing(ctx)
+		next, ok = m.nextPricingRefresh()
+	}
+
+	// restore the counters before pods start to finish
+	m.loadAccountingState()
 
 	m.GetNodes(ctx)
 
+	m.GetNamespaces(ctx)
+
+	m.GetOwners(ctx)
+
+	m.GetVolumes(ctx)
+
+	m.GetLoadBalancers(ctx)
+
 	m.GetPods(ctx)
+
+	// also started without periodic refreshes to load the prices of the operating systems of new nodes
+	go m.refreshPricingLoop(ctx, next, ok)
+
+	// first scrape is served right away
+	m.compute(ctx)
+	if m.computeInterval > 0 {
+		go m.computeLoop(ctx)
+	}
+
+	if m.accountingInterval > 0 {
+		go m.accountingLoop(ctx)
+	}
+
+	return nil
 }
 
 func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
 	prometheus.DescribeByCollect(m, ch)
 }
 
+// Collect serves the metrics of the last computation, scrapes never query the cluster
 func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.snapshotMtx.RLock()
+	snapshot := m.snapshot
+	m.snapshotMtx.RUnlock()
+
+	for _, metric := range snapshot {
+		ch <- metric
+	}
+}
+
+// computeCosts refreshes pod usage and sends the cost metrics to ch
+func (m *Metrics) computeCosts(ctx context.Context, ch chan<- prometheus.Metric) {
+	// the usage source is queried before taking the pods lock, pod updates must not wait for it
+	usage, err := m.GetUsage(ctx)
+	m.setUsageHealth(err)
+	if err != nil {
+		log.WithError(err).Warn("Failed to refresh pod usage, using last known usage")
+	}
+
 	m.podsMtx.Lock()
-	m.GetUsageCost()
+	if err == nil {
+		m.updateUsageCost(usage)
+	}
+	m.updateIdleCost()
+	// pods read the cost and instance of their node
+	m.nodesMtx.RLock()
+	volumes := m.updateStorageCost()
+	loadBalancers := m.loadBalancers()
 
-	podLabels := []string{"pod", "namespace", "node", "type", "lifecycle"}
+	podLabels := append([]string{}, podMetricLabels...)
 	if len(m.addPodLabels) > 0 {
 		for _, v := range m.addPodLabels {
 			podLabels = append(podLabels, sanitizeLabel(v))
@@ -75,6 +220,11 @@ func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
 	}
 
 	for _, pod := range m.Pods {
+		if pod.Node == nil || pod.Node.Cost == nil {
+			// pod is running on a node we could not price
+			continue
+		}
+
 		podLabelValues := []string{pod.Name, pod.Namespace, pod.Node.Name, pod.Node.Instance.Type, pod.Node.Cost.Type}
 		for _, l := range m.addPodLabels {
 			podLabelValues = append(podLabelValues, pod.Labels[l])
@@ -134,17 +284,308 @@ func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
 			pod.MemoryRequestsCost,
 			podLabelValues...,
 		)
+
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_pod_gpu",
+				"Cost of the pod GPU requests.",
+				podLabels, nil,
+			),
+			prometheus.GaugeValue,
+			pod.GpuCost,
+			podLabelValues...,
+		)
+
+		if len(pod.Claims) > 0 {
+			ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc(
+					namespace+"_pod_storage",
+					"Cost of the EBS volumes mounted by the pod, split between the pods mounting the same claim.",
+					podLabels, nil,
+				),
+				prometheus.GaugeValue,
+				pod.StorageCost,
+				podLabelValues...,
+			)
+		}
+
+		m.spentMtx.Lock()
+		spent, ok := m.podSpent[pod.Namespace+"/"+pod.Name]
+		m.spentMtx.Unlock()
+		if ok {
+			ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc(
+					namespace+"_pod_spent_dollars_total",
+					"Accumulated cost of the pod since it was first seen, integrated over time.",
+					podLabels, nil,
+				),
+				prometheus.CounterValue,
+				spent,
+				podLabelValues...,
+			)
+		}
+
+		if m.idleAllocation != IdleAllocationNone {
+			ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc(
+					namespace+"_pod_total_with_idle",
+					"Total cost of the pod plus its share of the node idle cost.",
+					podLabels, nil,
+				),
+				prometheus.GaugeValue,
+				pod.TotalWithIdle,
+				podLabelValues...,
+			)
+		}
+	}
+
+	workloadLabels := []string{"namespace", "kind", "name"}
+	for workload, cost := range m.workloadCosts() {
+		workloadLabelValues := []string{workload.Namespace, workload.Kind, workload.Name}
+
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_workload_total",
+				"Total cost of the pods of a workload, resolved from their controller ownerReferences.",
+				workloadLabels, nil,
+			),
+			prometheus.GaugeValue,
+			cost.Total,
+			workloadLabelValues...,
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_workload_cpu",
+				"Cost of the workload cpu, the max of usage and requests of each pod.",
+				workloadLabels, nil,
+			),
+			prometheus.GaugeValue,
+			cost.VCpu,
+			workloadLabelValues...,
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_workload_memory",
+				"Cost of the workload memory, the max of usage and requests of each pod.",
+				workloadLabels, nil,
+			),
+			prometheus.GaugeValue,
+			cost.Memory,
+			workloadLabelValues...,
+		)
+	}
+
+	namespaceLabels := append([]string{}, namespaceMetricLabels...)
+	for _, v := range m.addNamespaceLabels {
+		namespaceLabels = append(namespaceLabels, sanitizeLabel(v))
+	}
+	for _, v := range m.addNamespaceAnnotations {
+		namespaceLabels = append(namespaceLabels, "annotation_"+sanitizeLabel(v))
+	}
+
+	controlPlaneSupport := m.controlPlaneSupportTier(m.controlPlaneSupport)
+	controlPlane := m.controlPlaneCost(controlPlaneSupport)
+	namespaceCosts := m.namespaceCosts(volumes, loadBalancers)
+	if m.controlPlaneAllocation == ControlPlaneAllocationCompute {
+		distributeControlPlaneCost(controlPlane, namespaceCosts)
+	}
+
+	m.namespacesMtx.RLock()
+	for name, cost := range namespaceCosts {
+		namespaceLabelValues := []string{name}
+		ns := m.Namespaces[name]
+		for _, l := range m.addNamespaceLabels {
+			if ns != nil {
+				namespaceLabelValues = append(namespaceLabelValues, ns.Labels[l])
+			} else {
+				namespaceLabelValues = append(namespaceLabelValues, "")
+			}
+		}
+		for _, a := range m.addNamespaceAnnotations {
+			if ns != nil {
+				namespaceLabelValues = append(namespaceLabelValues, ns.Annotations[a])
+			} else {
+				namespaceLabelValues = append(namespaceLabelValues, "")
+			}
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_namespace_total",
+				"Total cost of the pods of the namespace, if requests is bigger than current usage then considers the requests cost.",
+				namespaceLabels, nil,
+			),
+			prometheus.GaugeValue,
+			cost.Total,
+			namespaceLabelValues...,
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_namespace_cpu",
+				"Cost of the namespace cpu usage.",
+				namespaceLabels, nil,
+			),
+			prometheus.GaugeValue,
+			cost.VCpu,
+			namespaceLabelValues...,
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_namespace_memory",
+				"Cost of the namespace memory usage.",
+				namespaceLabels, nil,
+			),
+			prometheus.GaugeValue,
+			cost.Memory,
+			namespaceLabelValues...,
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_namespace_cpu_requests",
+				"Cost of the namespace cpu requests.",
+				namespaceLabels, nil,
+			),
+			prometheus.GaugeValue,
+			cost.VCpuRequests,
+			namespaceLabelValues...,
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_namespace_memory_requests",
+				"Cost of the namespace memory requests.",
+				namespaceLabels, nil,
+			),
+			prometheus.GaugeValue,
+			cost.MemoryRequests,
+			namespaceLabelValues...,
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_namespace_storage",
+				"Cost of the EBS volumes claimed by the namespace.",
+				namespaceLabels, nil,
+			),
+			prometheus.GaugeValue,
+			cost.Storage,
+			namespaceLabelValues...,
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_namespace_loadbalancer",
+				"Cost of the load balancers of the Services and Ingresses of the namespace.",
+				namespaceLabels, nil,
+			),
+			prometheus.GaugeValue,
+			cost.LoadBalancer,
+			namespaceLabelValues...,
+		)
+
+		if m.controlPlaneAllocation == ControlPlaneAllocationCompute {
+			ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc(
+					namespace+"_namespace_control_plane",
+					"Share of the cluster control plane cost, proportional to the compute cost of the namespace.",
+					namespaceLabels, nil,
+				),
+				prometheus.GaugeValue,
+				cost.ControlPlane,
+				namespaceLabelValues...,
+			)
+		}
 	}
+	m.namespacesMtx.RUnlock()
+	m.nodesMtx.RUnlock()
 	m.podsMtx.Unlock()
 
-	nodeLabels := []string{"node", "region", "az", "type", "lifecycle"}
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc(
+			namespace+"_cluster_control_plane",
+			"Hourly cost of the EKS cluster control plane.",
+			[]string{"support"}, nil,
+		),
+		prometheus.GaugeValue,
+		controlPlane,
+		controlPlaneSupport,
+	)
+
+	for _, lb := range loadBalancers {
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_loadbalancer_total",
+				"Fixed hourly cost of the load balancer of a Service or Ingress, ingresses sharing an ALB split its cost.",
+				[]string{"namespace", "name", "type"}, nil,
+			),
+			prometheus.GaugeValue,
+			lb.Cost,
+			lb.Namespace, lb.Name, lb.Type,
+		)
+	}
+
+	for _, volume := range volumes {
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_pv_total",
+				"Cost of the EBS volume, including the IOPS and throughput provisioned above the baseline.",
+				[]string{"persistentvolume", "storageclass", "volume_type", "volume_type_inferred", "namespace", "claim"}, nil,
+			),
+			prometheus.GaugeValue,
+			volume.Cost,
+			volume.Name, volume.StorageClass, volume.Type, strconv.FormatBool(volume.TypeInferred), volume.ClaimNamespace, volume.ClaimName,
+		)
+	}
+
+	m.spentMtx.Lock()
+	for name, spent := range m.finishedNamespaces {
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_namespace_finished_pods_dollars_total",
+				"Accumulated cost of the pods of the namespace that terminated, over their whole run.",
+				[]string{"namespace"}, nil,
+			),
+			prometheus.CounterValue,
+			spent,
+			name,
+		)
+	}
+
+	for key, spent := range m.finishedJobs {
+		ns, job, _ := strings.Cut(key, "/")
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_job_finished_pods_dollars_total",
+				"Accumulated cost of the pods of the Job that terminated, over their whole run.",
+				[]string{"namespace", "job"}, nil,
+			),
+			prometheus.CounterValue,
+			spent,
+			ns, job,
+		)
+	}
+	m.spentMtx.Unlock()
+
+	m.nodesMtx.RLock()
+	nodeLabels := append([]string{}, nodeMetricLabels...)
 	if len(m.addNodeLabels) > 0 {
 		for _, v := range m.addNodeLabels {
 			nodeLabels = append(nodeLabels, sanitizeLabel(v))
 		}
 	}
 
+	instanceTypes := make(map[string]*Instance)
 	for _, node := range m.Nodes {
+		if node.Cost == nil {
+			continue
+		}
+		instanceTypes[node.Instance.Type] = node.Instance
+
 		nodeLabelValues := []string{node.Name, node.Region, node.AZ, node.Instance.Type, node.Cost.Type}
 		for _, l := range m.addNodeLabels {
 			nodeLabelValues = append(nodeLabelValues, node.Labels[l])
@@ -161,6 +602,17 @@ func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
 			nodeLabelValues...,
 		)
 
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_node_price_info",
+				"Where the node price came from, e.g. the pricing provider or an override, the operating system it is priced for and the model of its GPUs, if any.",
+				[]string{"node", "type", "lifecycle", "os", "price_source", "gpu_model"}, nil,
+			),
+			prometheus.GaugeValue,
+			1,
+			node.Name, node.Instance.Type, node.Cost.Type, node.OS, node.Cost.Source, node.Instance.GpuModel,
+		)
+
 		ch <- prometheus.MustNewConstMetric(
 			prometheus.NewDesc(
 				namespace+"_node_cpu",
@@ -182,11 +634,141 @@ func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
 			node.Cost.Memory,
 			nodeLabelValues...,
 		)
+
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_node_gpu",
+				"Cost of each node GPU.",
+				nodeLabels, nil,
+			),
+			prometheus.GaugeValue,
+			node.Cost.Gpu,
+			nodeLabelValues...,
+		)
+
+		m.spentMtx.Lock()
+		spent, ok := m.nodeSpent[node.Name]
+		m.spentMtx.Unlock()
+		if ok {
+			ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc(
+					namespace+"_node_spent_dollars_total",
+					"Accumulated cost of the node since it was first seen, integrated over time.",
+					nodeLabels, nil,
+				),
+				prometheus.CounterValue,
+				spent,
+				nodeLabelValues...,
+			)
+		}
+
+		if node.IdleCost == nil {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_node_idle_cpu",
+				"Cost of the node CPU not used or requested by any pod.",
+				nodeLabels, nil,
+			),
+			prometheus.GaugeValue,
+			node.IdleCost.VCpu,
+			nodeLabelValues...,
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_node_idle_memory",
+				"Cost of the node memory not used or requested by any pod.",
+				nodeLabels, nil,
+			),
+			prometheus.GaugeValue,
+			node.IdleCost.Memory,
+			nodeLabelValues...,
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_node_idle_total",
+				"Total cost of the node not attributed to any pod, including GPUs.",
+				nodeLabels, nil,
+			),
+			prometheus.GaugeValue,
+			node.IdleCost.Total,
+			nodeLabelValues...,
+		)
+	}
+	m.nodesMtx.RUnlock()
+
+	for _, instance := range instanceTypes {
+		if instance.CpuMemRatio == 0 {
+			// e.g. fargate is priced per vCPU and memory
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				namespace+"_instance_cpu_memory_ratio",
+				"How many times one vCPU costs more than one GB of memory for the instance types in use.",
+				[]string{"type", "strategy"}, nil,
+			),
+			prometheus.GaugeValue,
+			instance.CpuMemRatio,
+			instance.Type, instance.CpuMemRatioStrategy,
+		)
 	}
 }
 
+// sanitizeLabel converts a Kubernetes label or annotation key to a label name, e.g. app.kubernetes.io/name to app_kubernetes_io_name
 func sanitizeLabel(label string) string {
-	return strings.Replace(strings.Replace(label, ".", "_", -1), "/", "_", -1)
+	return invalidLabelRe.ReplaceAllString(label, "_")
+}
+
+// ValidateLabels checks that the pod, node and namespace labels and the namespace annotations can be added to the
+// metrics, their names must be valid and not collide with each other or with the labels the metrics already have
+func ValidateLabels(podLabels, nodeLabels, namespaceLabels, namespaceAnnotations []string) error {
+	if err := validateLabelNames(podMetricLabels, map[string][]string{"": podLabels}); err != nil {
+		return fmt.Errorf("invalid pod labels: %w", err)
+	}
+	if err := validateLabelNames(nodeMetricLabels, map[string][]string{"": nodeLabels}); err != nil {
+		return fmt.Errorf("invalid node labels: %w", err)
+	}
+	if err := validateLabelNames(namespaceMetricLabels, map[string][]string{"": namespaceLabels, "annotation_": namespaceAnnotations}); err != nil {
+		return fmt.Errorf("invalid namespace labels or annotations: %w", err)
+	}
+
+	return nil
+}
+
+// validateLabelNames checks the label names of keys, the sanitized key with the prefix it is mapped to, against the fixed labels
+func validateLabelNames(fixed []string, keys map[string][]string) error {
+	used := make(map[string]string)
+	for _, label := range fixed {
+		used[label] = "the metric"
+	}
+
+	// sorted so the same configuration always reports the same collision
+	prefixes := make([]string, 0, len(keys))
+	for prefix := range keys {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	for _, prefix := range prefixes {
+		for _, key := range keys[prefix] {
+			name := prefix + sanitizeLabel(key)
+			if !labelNameRe.MatchString(name) || strings.HasPrefix(name, "__") {
+				return fmt.Errorf("%q is not a valid label name", key)
+			}
+			if other, ok := used[name]; ok {
+				return fmt.Errorf("%q is exposed as %s, which is already used by %s", key, name, other)
+			}
+			used[name] = strconv.Quote(key)
+		}
+	}
+
+	return nil
 }
 
 func timeTrack(start time.Time, name string) {
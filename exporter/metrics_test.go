@@ -0,0 +1,52 @@
+package exporter
+
+import (
+	"testing"
+)
+
+func TestSanitizeLabel(t *testing.T) {
+	tests := map[string]string{
+		"team":                   "team",
+		"app.kubernetes.io/name": "app_kubernetes_io_name",
+		"cost-center":            "cost_center",
+		"example.com/owner~id":   "example_com_owner_id",
+	}
+
+	for label, want := range tests {
+		if got := sanitizeLabel(label); got != want {
+			t.Errorf("sanitizeLabel(%q) = %q, want %q", label, got, want)
+		}
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	tests := []struct {
+		name                 string
+		podLabels            []string
+		nodeLabels           []string
+		namespaceLabels      []string
+		namespaceAnnotations []string
+		wantErr              bool
+	}{
+		{"valid", []string{"app.kubernetes.io/name", "cost-center"}, []string{"karpenter.sh/nodepool"}, []string{"team"}, []string{"team"}, false},
+		{"none", nil, nil, nil, nil, false},
+		{"collides with a pod metric label", []string{"type"}, nil, nil, nil, true},
+		{"collides with a node metric label", nil, []string{"lifecycle"}, nil, nil, true},
+		{"sanitized to the same name", []string{"team.name", "team/name"}, nil, nil, nil, true},
+		{"duplicate", nil, nil, []string{"team", "team"}, nil, true},
+		{"label collides with an annotation", nil, nil, []string{"annotation_team"}, []string{"team"}, true},
+		{"empty", []string{""}, nil, nil, nil, true},
+		{"starts with a digit", nil, []string{"1password.com/vault"}, nil, nil, true},
+		{"reserved", []string{"__name"}, nil, nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateLabels(tt.podLabels, tt.nodeLabels, tt.namespaceLabels, tt.namespaceAnnotations)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package exporter
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// namespaceCost is the cost of all the pods of a namespace
+type namespaceCost struct {
+	Total          float64
+	VCpu           float64
+	Memory         float64
+	VCpuRequests   float64
+	MemoryRequests float64
+	Storage        float64
+	LoadBalancer   float64
+	ControlPlane   float64
+}
+
+func (m *Metrics) GetNamespaces(ctx context.Context) {
+	now := time.Now()
+	defer timeTrack(now, "Retrieving current namespace list")
+
+	informer := m.informers.Core().V1().Namespaces().Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    m.namespaceCreated,
+		DeleteFunc: m.namespaceRemoved,
+		UpdateFunc: m.namespaceUpdated,
+	})
+
+	m.informers.Start(ctx.Done())
+	waitForHandler(ctx, informer, &m.namespacesAdded)
+}
+
+func (m *Metrics) namespaceCreated(obj interface{}) {
+	defer atomic.AddInt64(&m.namespacesAdded, 1)
+
+	ns, ok := obj.(*corev1.Namespace)
+	if !ok {
+		return
+	}
+
+	log.Debugf("Namespace created: %s", ns.ObjectMeta.Name)
+
+	m.setNamespace(ns)
+}
+
+func (m *Metrics) setNamespace(ns *corev1.Namespace) {
+	m.settingsMtx.RLock()
+	tmp := Namespace{
+		Name:        ns.ObjectMeta.Name,
+		Labels:      exposedLabels(m.addNamespaceLabels, ns.ObjectMeta.Labels),
+		Annotations: exposedLabels(m.addNamespaceAnnotations, ns.ObjectMeta.Annotations),
+	}
+	m.settingsMtx.RUnlock()
+
+	m.namespacesMtx.Lock()
+	m.Namespaces[ns.ObjectMeta.Name] = &tmp
+	m.namespacesMtx.Unlock()
+}
+
+func (m *Metrics) namespaceUpdated(oldObj, newObj interface{}) {
+	// labels and annotations may have changed, just replace it
+	ns, ok := newObj.(*corev1.Namespace)
+	if !ok {
+		return
+	}
+
+	m.setNamespace(ns)
+}
+
+func (m *Metrics) namespaceRemoved(obj interface{}) {
+	ns, ok := obj.(*corev1.Namespace)
+	if !ok {
+		return
+	}
+
+	log.Debugf("Namespace removed: %s", ns.ObjectMeta.Name)
+
+	m.namespacesMtx.Lock()
+	delete(m.Namespaces, ns.ObjectMeta.Name)
+	m.namespacesMtx.Unlock()
+}
+
+// namespaceCosts aggregates the cost of the pods, claimed volumes and load balancers by namespace,
+// caller must hold the pods lock and the nodes lock
+func (m *Metrics) namespaceCosts(volumes []*Volume, loadBalancers []*LoadBalancer) map[string]*namespaceCost {
+	namespaces := make(map[string]*namespaceCost)
+	for _, pod := range m.Pods {
+		if pod.Node == nil || pod.Node.Cost == nil {
+			continue
+		}
+
+		cost, ok := namespaces[pod.Namespace]
+		if !ok {
+			cost = &namespaceCost{}
+			namespaces[pod.Namespace] = cost
+		}
+
+		cost.Total += pod.Cost
+		cost.VCpu += pod.VCpuCost
+		cost.Memory += pod.MemoryCost
+		cost.VCpuRequests += pod.VCpuRequestsCost
+		cost.MemoryRequests += pod.MemoryRequestsCost
+	}
+
+	// volumes are charged to the namespace of their claim even if no pod mounts it
+	for _, volume := range volumes {
+		if volume.ClaimNamespace == "" {
+			continue
+		}
+
+		cost, ok := namespaces[volume.ClaimNamespace]
+		if !ok {
+			cost = &namespaceCost{}
+			namespaces[volume.ClaimNamespace] = cost
+		}
+
+		cost.Storage += volume.Cost
+	}
+
+	for _, lb := range loadBalancers {
+		cost, ok := namespaces[lb.Namespace]
+		if !ok {
+			cost = &namespaceCost{}
+			namespaces[lb.Namespace] = cost
+		}
+
+		cost.LoadBalancer += lb.Cost
+	}
+
+	return namespaces
+}
+
+// exposedLabels returns the values of the keys that should be added as metric labels
+func exposedLabels(keys []string, values map[string]string) map[string]string {
+	d := make(map[string]string, 0)
+	for _, key := range keys {
+		if v, ok := values[key]; ok {
+			d[key] = v
+		}
+	}
+
+	return d
+}
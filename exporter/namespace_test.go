@@ -0,0 +1,48 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNamespaceCosts(t *testing.T) {
+	node := &Node{Name: "node", Cost: &Ec2Cost{Type: "ondemand", VCpu: 0.04, Memory: 0.005}}
+
+	m := newTestMetrics(&fakePricingProvider{})
+	m.Pods = map[string]*Pod{
+		"default/a": {Namespace: "default", Node: node, Cost: 0.05, VCpuCost: 0.04, MemoryCost: 0.01, VCpuRequestsCost: 0.02, MemoryRequestsCost: 0.01},
+		"default/b": {Namespace: "default", Node: node, Cost: 0.02, VCpuRequestsCost: 0.02},
+		"other/c":   {Namespace: "other", Node: node, Cost: 0.01, MemoryCost: 0.01},
+		// not scheduled yet
+		"pending/d": {Namespace: "pending", Cost: 0.1},
+	}
+
+	got := m.namespaceCosts(nil, nil)
+
+	want := map[string]*namespaceCost{
+		"default": {Total: 0.07, VCpu: 0.04, Memory: 0.01, VCpuRequests: 0.04, MemoryRequests: 0.01},
+		"other":   {Total: 0.01, Memory: 0.01},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got namespaces %v, want %v", got, want)
+	}
+	for name, w := range want {
+		g, ok := got[name]
+		if !ok {
+			t.Errorf("namespace %s not found", name)
+			continue
+		}
+		if !almostEqual(g.Total, w.Total) || !almostEqual(g.VCpu, w.VCpu) || !almostEqual(g.Memory, w.Memory) ||
+			!almostEqual(g.VCpuRequests, w.VCpuRequests) || !almostEqual(g.MemoryRequests, w.MemoryRequests) {
+			t.Errorf("namespace %s: got %+v, want %+v", name, g, w)
+		}
+	}
+}
+
+func TestExposedLabels(t *testing.T) {
+	got := exposedLabels([]string{"team", "cost-center"}, map[string]string{"team": "payments", "env": "prod"})
+
+	if want := map[string]string{"team": "payments"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
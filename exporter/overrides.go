@@ -0,0 +1,111 @@
+package exporter
+
+import (
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// PricingOverrides adjusts the prices retrieved from the pricing provider, e.g. with negotiated rates
+type PricingOverrides struct {
+	// Discount is the percentage discounted from every price, e.g. an Enterprise Discount Program
+	Discount float64 `json:"discount"`
+	// InstanceTypes sets the hourly on-demand price of an instance type
+	InstanceTypes map[string]float64 `json:"instanceTypes"`
+	// Families sets the hourly on-demand price per vCPU of the instance types of a family,
+	// an instance type override takes precedence
+	Families map[string]float64 `json:"families"`
+	// Lifecycles multiplies the prices of a lifecycle: ondemand, spot, fargate, reserved or savingsplan
+	Lifecycles map[string]float64 `json:"lifecycles"`
+}
+
+// LoadPricingOverrides reads the pricing overrides from a YAML file
+func LoadPricingOverrides(path string) (*PricingOverrides, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var o PricingOverrides
+	if err := yaml.UnmarshalStrict(data, &o); err != nil {
+		return nil, fmt.Errorf("could not parse pricing overrides %s: %w", path, err)
+	}
+
+	if o.Discount < 0 || o.Discount > 100 {
+		return nil, fmt.Errorf("discount must be a percentage between 0 and 100, got %v", o.Discount)
+	}
+
+	for lifecycle, multiplier := range o.Lifecycles {
+		switch lifecycle {
+		case "ondemand", "spot", "fargate", "reserved", "savingsplan":
+		default:
+			return nil, fmt.Errorf("unknown lifecycle %q in pricing overrides", lifecycle)
+		}
+
+		if multiplier < 0 {
+			return nil, fmt.Errorf("multiplier of lifecycle %s must not be negative, got %v", lifecycle, multiplier)
+		}
+	}
+
+	return &o, nil
+}
+
+// apply returns the final hourly price of an instance and the source of that price. Hourly overrides
+// only replace Linux on-demand prices, the lifecycle multiplier and the discount are then applied to every price.
+func (o *PricingOverrides) apply(lifecycle string, instance *Instance, value float64, source string) (float64, string) {
+	if lifecycle == "ondemand" {
+		value, source = o.onDemandPrice(instance, value, source)
+	}
+
+	return o.adjust(lifecycle, value, source)
+}
+
+// onDemandPrice returns the hourly on-demand price of an instance after the instance type and family overrides
+func (o *PricingOverrides) onDemandPrice(instance *Instance, value float64, source string) (float64, string) {
+	if o == nil || instance == nil || instance.OS != OSLinux {
+		return value, source
+	}
+
+	if price, ok := o.InstanceTypes[instance.Type]; ok {
+		return price, "override"
+	}
+	if price, ok := o.Families[instanceFamily(instance.Type)]; ok {
+		return price * float64(instance.VCpu), "override"
+	}
+
+	return value, source
+}
+
+// adjust applies the lifecycle multiplier and the discount to a price
+func (o *PricingOverrides) adjust(lifecycle string, value float64, source string) (float64, string) {
+	if o == nil {
+		return value, source
+	}
+
+	if multiplier, ok := o.lifecycleMultiplier(lifecycle); ok {
+		value = value * multiplier
+		source = source + "+multiplier"
+	}
+
+	if o.Discount > 0 {
+		value = value * (1 - o.Discount/100)
+		source = source + "+discount"
+	}
+
+	return value, source
+}
+
+// lifecycleMultiplier returns the multiplier of a lifecycle and whether there is one
+func (o *PricingOverrides) lifecycleMultiplier(lifecycle string) (float64, bool) {
+	if o == nil {
+		return 1, false
+	}
+
+	multiplier, ok := o.Lifecycles[lifecycle]
+	if !ok {
+		return 1, false
+	}
+
+	return multiplier, true
+}
@@ -0,0 +1,41 @@
+package exporter
+
+import (
+	"testing"
+)
+
+func TestPricingOverridesApply(t *testing.T) {
+	overrides := &PricingOverrides{
+		Discount:      10,
+		InstanceTypes: map[string]float64{"m5.large": 0.08},
+		Families:      map[string]float64{"c5": 0.03},
+		Lifecycles:    map[string]float64{"spot": 0.5},
+	}
+
+	tests := []struct {
+		name       string
+		overrides  *PricingOverrides
+		lifecycle  string
+		instance   *Instance
+		value      float64
+		want       float64
+		wantSource string
+	}{
+		{"no overrides", nil, "ondemand", &Instance{Type: "m5.large", OS: OSLinux}, 0.096, 0.096, "fake"},
+		{"instance type", overrides, "ondemand", &Instance{Type: "m5.large", OS: OSLinux}, 0.096, 0.08 * 0.9, "override+discount"},
+		{"family", overrides, "ondemand", &Instance{Type: "c5.xlarge", OS: OSLinux, VCpu: 4}, 0.17, 0.12 * 0.9, "override+discount"},
+		{"instance type of another operating system", overrides, "ondemand", &Instance{Type: "m5.large", OS: OSWindows}, 0.188, 0.188 * 0.9, "fake+discount"},
+		{"not overridden", overrides, "ondemand", &Instance{Type: "r5.large", OS: OSLinux}, 0.126, 0.126 * 0.9, "fake+discount"},
+		{"spot multiplier", overrides, "spot", &Instance{Type: "m5.large", OS: OSLinux}, 0.04, 0.04 * 0.5 * 0.9, "fake+multiplier+discount"},
+		{"without instance", overrides, "fargate", nil, 0.04, 0.04 * 0.9, "fake+discount"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, source := tt.overrides.apply(tt.lifecycle, tt.instance, tt.value, "fake")
+			if !almostEqual(got, tt.want) || source != tt.wantSource {
+				t.Errorf("got %v from %s, want %v from %s", got, source, tt.want, tt.wantSource)
+			}
+		})
+	}
+}
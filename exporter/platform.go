@@ -0,0 +1,92 @@
+package exporter
+
+import (
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// operating systems nodes are priced for
+const (
+	OSLinux   = "linux"
+	OSWindows = "windows"
+	OSRHEL    = "rhel"
+	OSSUSE    = "suse"
+)
+
+// operatingSystems are the price list operatingSystem attribute and the spot product description of each
+// supported operating system, license included
+var operatingSystems = map[string]struct {
+	PriceList string
+	Spot      string
+}{
+	OSLinux:   {PriceList: "Linux", Spot: "Linux/UNIX"},
+	OSWindows: {PriceList: "Windows", Spot: "Windows"},
+	OSRHEL:    {PriceList: "RHEL", Spot: "Red Hat Enterprise Linux"},
+	OSSUSE:    {PriceList: "SUSE", Spot: "SUSE Linux"},
+}
+
+// nodeOS returns the operating system a node is billed for, from its kubernetes.io/os label and OS image,
+// e.g. "Red Hat Enterprise Linux 8.6 (Ootpa)" or "SUSE Linux Enterprise Server 15 SP4"
+func nodeOS(node *corev1.Node) string {
+	if node.ObjectMeta.Labels["kubernetes.io/os"] == "windows" {
+		return OSWindows
+	}
+
+	image := strings.ToLower(node.Status.NodeInfo.OSImage)
+	switch {
+	case strings.HasPrefix(image, "red hat enterprise linux"):
+		return OSRHEL
+	case strings.HasPrefix(image, "suse linux enterprise"):
+		return OSSUSE
+	}
+
+	return OSLinux
+}
+
+// instanceKey is the key of an instance type priced for an operating system in the Instances map,
+// Linux instances are keyed by their type alone
+func instanceKey(instanceType string, operatingSystem string) string {
+	if operatingSystem == "" || operatingSystem == OSLinux {
+		return instanceType
+	}
+
+	return instanceType + "/" + operatingSystem
+}
+
+// pricedOperatingSystems returns the operating systems prices are loaded for, Linux first
+func (m *Metrics) pricedOperatingSystems() []string {
+	m.instancesMtx.RLock()
+	defer m.instancesMtx.RUnlock()
+
+	result := []string{OSLinux}
+	for operatingSystem := range m.operatingSystems {
+		if operatingSystem != OSLinux {
+			result = append(result, operatingSystem)
+		}
+	}
+	sort.Strings(result[1:])
+
+	return result
+}
+
+// requestOSPricing adds operatingSystem to the operating systems prices are loaded for and schedules a pricing refresh,
+// it returns false if its prices were already requested
+func (m *Metrics) requestOSPricing(operatingSystem string) bool {
+	m.instancesMtx.Lock()
+	_, ok := m.operatingSystems[operatingSystem]
+	m.operatingSystems[operatingSystem] = struct{}{}
+	m.instancesMtx.Unlock()
+	if ok {
+		return false
+	}
+
+	select {
+	case m.pricingRefresh <- struct{}{}:
+	default:
+		// a refresh is already pending
+	}
+
+	return true
+}
@@ -0,0 +1,56 @@
+package exporter
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNodeOS(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		osImage string
+		want    string
+	}{
+		{"amazon linux", map[string]string{"kubernetes.io/os": "linux"}, "Amazon Linux 2", OSLinux},
+		{"bottlerocket", map[string]string{"kubernetes.io/os": "linux"}, "Bottlerocket OS 1.19.0 (aws-k8s-1.29)", OSLinux},
+		{"windows", map[string]string{"kubernetes.io/os": "windows"}, "Windows Server 2022 Datacenter", OSWindows},
+		{"rhel", map[string]string{"kubernetes.io/os": "linux"}, "Red Hat Enterprise Linux 8.6 (Ootpa)", OSRHEL},
+		{"suse", map[string]string{"kubernetes.io/os": "linux"}, "SUSE Linux Enterprise Server 15 SP4", OSSUSE},
+		{"unlabeled", nil, "", OSLinux},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Labels: tt.labels},
+				Status:     corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{OSImage: tt.osImage}},
+			}
+
+			if got := nodeOS(node); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstanceKey(t *testing.T) {
+	tests := []struct {
+		instanceType string
+		os           string
+		want         string
+	}{
+		{"m5.large", OSLinux, "m5.large"},
+		{"m5.large", "", "m5.large"},
+		{"m5.large", OSWindows, "m5.large/windows"},
+		{"m5.large", OSRHEL, "m5.large/rhel"},
+	}
+
+	for _, tt := range tests {
+		if got := instanceKey(tt.instanceType, tt.os); got != tt.want {
+			t.Errorf("instanceKey(%q, %q) = %q, want %q", tt.instanceType, tt.os, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PriceList mirrors the layout of the AWS bulk price-list offer files
+// https://docs.aws.amazon.com/awsaccountbilling/latest/aboutv2/reading-an-offer.html
+type PriceList struct {
+	FormatVersion   string
+	OfferCode       string
+	Version         string
+	PublicationDate string
+	Products        map[string]Product
+	Terms           map[string]map[string]map[string]SKU
+}
+
+// FilePricingProvider reads prices from bulk price-list files instead of calling the AWS APIs,
+// spot prices are not part of the price list so spot nodes are priced as on-demand
+type FilePricingProvider struct {
+	region  string
+	filters PricingFilters
+	offers  map[string]*PriceList
+}
+
+// NewFilePricingProvider loads the price lists from path, which can either be a single file
+// or a directory (e.g. a ConfigMap mount) containing one json file per offer
+func NewFilePricingProvider(path string, region string, filters PricingFilters) (*FilePricingProvider, error) {
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		return nil, fmt.Errorf("Please configure the region or the AWS_REGION environment variable")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files, err = filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p := &FilePricingProvider{region: region, filters: filters, offers: make(map[string]*PriceList)}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var offer PriceList
+		if err := json.Unmarshal(data, &offer); err != nil {
+			return nil, fmt.Errorf("could not parse price list %s: %w", file, err)
+		}
+
+		log.Debugf("Loaded %d %s products from %s", len(offer.Products), offer.OfferCode, file)
+		p.offers[offer.OfferCode] = &offer
+	}
+
+	return p, nil
+}
+
+func (p *FilePricingProvider) Name() string {
+	return "file"
+}
+
+func (p *FilePricingProvider) Region() string {
+	return p.region
+}
+
+func (p *FilePricingProvider) Fingerprint() string {
+	return pricingFingerprint(p.Name(), p.region, p.filters)
+}
+
+// products returns the products of an offer matching all the filters, the same way GetProducts would
+func (p *FilePricingProvider) products(serviceCode string, filters map[string]string) ([]Pricing, error) {
+	offer, ok := p.offers[serviceCode]
+	if !ok {
+		return nil, fmt.Errorf("price list for %s not found", serviceCode)
+	}
+
+	products := make([]Pricing, 0)
+	for sku, product := range offer.Products {
+		matches := true
+		for field, value := range filters {
+			if product.Attributes[field] != value {
+				matches = false
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+
+		products = append(products, Pricing{
+			Product:     product,
+			ServiceCode: serviceCode,
+			Terms:       Terms{OnDemand: offer.Terms["OnDemand"][sku]},
+		})
+	}
+
+	return products, nil
+}
+
+func (p *FilePricingProvider) InstanceTypes(ctx context.Context) (map[string]*Instance, error) {
+	products, err := p.products("AmazonEC2", p.filters.ec2(p.region, OSLinux))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]*Instance, 0)
+	for _, product := range products {
+		instanceType := product.Product.Attributes["instanceType"]
+
+		vcpu, err := strconv.Atoi(product.Product.Attributes["vcpu"])
+		if err != nil {
+			// without vCPUs and memory the price cannot be split, the instance type is left unpriced
+			log.WithError(err).Warnf("Failed to parse the vCPUs of %s", instanceType)
+			continue
+		}
+
+		// memory is formatted as "16 GiB" or "1,024 GiB"
+		memory, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSuffix(product.Product.Attributes["memory"], " GiB"), ",", ""), 64)
+		if err != nil {
+			log.WithError(err).Warnf("Failed to parse the memory of %s", instanceType)
+			continue
+		}
+
+		// the price list only has the number of GPUs, not their model
+		gpu, _ := strconv.Atoi(product.Product.Attributes["gpu"])
+
+		result[instanceType] = &Instance{
+			Memory: int64(memory * 1024),
+			VCpu:   int32(vcpu),
+			Gpu:    int32(gpu),
+			Type:   instanceType,
+		}
+	}
+
+	return result, nil
+}
+
+func (p *FilePricingProvider) OnDemandPricing(ctx context.Context, operatingSystem string) (map[string]float64, error) {
+	products, err := p.products("AmazonEC2", p.filters.ec2(p.region, operatingSystem))
+	if err != nil {
+		return nil, err
+	}
+
+	return onDemandPricing(products), nil
+}
+
+func (p *FilePricingProvider) SpotPricing(ctx context.Context, operatingSystem string) (map[string]map[string]float64, error) {
+	return map[string]map[string]float64{}, nil
+}
+
+func (p *FilePricingProvider) EKSPricing(ctx context.Context) (*EKSPrices, error) {
+	products, err := p.products("AmazonEKS", p.filters.eks(p.region))
+	if err != nil {
+		return nil, err
+	}
+
+	return &EKSPrices{Fargate: fargatePricing(products), ControlPlane: controlPlanePricing(products)}, nil
+}
+
+func (p *FilePricingProvider) VolumePricing(ctx context.Context) (map[string]*VolumePrice, error) {
+	storage, err := p.products("AmazonEC2", ebsStorageFilters(p.region))
+	if err != nil {
+		return nil, err
+	}
+
+	iops, err := p.products("AmazonEC2", ebsIopsFilters(p.region))
+	if err != nil {
+		return nil, err
+	}
+
+	throughput, err := p.products("AmazonEC2", ebsThroughputFilters(p.region))
+	if err != nil {
+		return nil, err
+	}
+
+	return volumePricing(storage, iops, throughput), nil
+}
+
+func (p *FilePricingProvider) LoadBalancerPricing(ctx context.Context) (map[string]float64, error) {
+	prices := make(map[string]float64, len(loadBalancerFamilies))
+	if _, ok := p.offers["AWSELB"]; !ok {
+		// price lists downloaded before load balancers were priced
+		log.Warn("Price list for AWSELB not found, load balancers will not be priced")
+		return prices, nil
+	}
+
+	for lbType, family := range loadBalancerFamilies {
+		products, err := p.products("AWSELB", elbProductFilters(p.region, family))
+		if err != nil {
+			return nil, err
+		}
+
+		if price, ok := loadBalancerPrice(products); ok {
+			prices[lbType] = price
+		}
+	}
+
+	return prices, nil
+}
+
+// DownloadPriceLists retrieves the products used by the exporter from the Pricing API and writes them
+// to dir as bulk price-list files, one per offer, that can be later loaded by FilePricingProvider
+func DownloadPriceLists(ctx context.Context, dir string, region string, filters PricingFilters) error {
+	p, err := NewAWSPricingProvider(ctx, region, filters)
+	if err != nil {
+		return err
+	}
+
+	offers := map[string][]map[string]string{
+		"AmazonEC2": {
+			p.filters.ec2(p.config.Region, OSLinux),
+			p.filters.ec2(p.config.Region, OSWindows),
+			p.filters.ec2(p.config.Region, OSRHEL),
+			p.filters.ec2(p.config.Region, OSSUSE),
+			ebsStorageFilters(p.config.Region),
+			ebsIopsFilters(p.config.Region),
+			ebsThroughputFilters(p.config.Region),
+		},
+		"AmazonEKS": {p.filters.eks(p.config.Region)},
+		"AWSELB": {
+			elbProductFilters(p.config.Region, loadBalancerFamilies[LoadBalancerClassic]),
+			elbProductFilters(p.config.Region, loadBalancerFamilies[LoadBalancerNetwork]),
+			elbProductFilters(p.config.Region, loadBalancerFamilies[LoadBalancerApplication]),
+		},
+	}
+
+	for offerCode, queries := range offers {
+		products := []Pricing{}
+		for _, filters := range queries {
+			result, err := p.getProducts(ctx, offerCode, filters)
+			if err != nil {
+				return err
+			}
+			products = append(products, result...)
+		}
+
+		offer := PriceList{
+			FormatVersion:   "v1.0",
+			OfferCode:       offerCode,
+			PublicationDate: time.Now().UTC().Format(time.RFC3339),
+			Products:        make(map[string]Product, len(products)),
+			Terms:           map[string]map[string]map[string]SKU{"OnDemand": {}},
+		}
+		for _, product := range products {
+			// only on-demand terms are used, reserved terms would just bloat the file
+			offer.Products[product.Product.Sku] = product.Product
+			offer.Terms["OnDemand"][product.Product.Sku] = product.Terms.OnDemand
+		}
+
+		data, err := json.Marshal(offer)
+		if err != nil {
+			return err
+		}
+
+		file := filepath.Join(dir, offerCode+".json")
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			return err
+		}
+
+		log.Infof("Wrote %d %s products to %s", len(products), offerCode, file)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package exporter
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFilePricingProviderOnDemandPricing(t *testing.T) {
+	// user filters must not replace the operating system and license of each query
+	filters := PricingFilters{EC2: map[string]string{
+		"operatingSystem":   "Linux",
+		"licenseModel":      "Bring your own license",
+		"currentGeneration": "Yes",
+	}}
+
+	p, err := NewFilePricingProvider("testdata/pricelist", "us-east-1", filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		os   string
+		want map[string]float64
+	}{
+		{OSLinux, map[string]float64{"m5.large": 0.096, "m6g.large": 0.077, "x2iedn.16xlarge": 13.338}},
+		{OSWindows, map[string]float64{"m5.large": 0.188}},
+		{OSRHEL, map[string]float64{"m5.large": 0.156}},
+		{OSSUSE, map[string]float64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.os, func(t *testing.T) {
+			got, err := p.OnDemandPricing(context.Background(), tt.os)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for instanceType, price := range tt.want {
+				if got[instanceType] != price {
+					t.Errorf("%s: got %v, want %v", instanceType, got[instanceType], price)
+				}
+			}
+		})
+	}
+}
+
+func TestFilePricingProviderInstanceTypes(t *testing.T) {
+	p, err := NewFilePricingProvider("testdata/pricelist", "us-east-1", PricingFilters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instances, err := p.InstanceTypes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(instances) != 3 {
+		t.Fatalf("got %v, want m5.large, m6g.large and x2iedn.16xlarge", instances)
+	}
+
+	tests := []struct {
+		instanceType string
+		vcpu         int32
+		memory       int64
+	}{
+		{"m5.large", 2, 8192},
+		// memory above 1 TiB has a thousands separator
+		{"x2iedn.16xlarge", 64, 2048 * 1024},
+	}
+
+	for _, tt := range tests {
+		instance, ok := instances[tt.instanceType]
+		if !ok {
+			t.Errorf("%s not found", tt.instanceType)
+			continue
+		}
+		if instance.VCpu != tt.vcpu || instance.Memory != tt.memory {
+			t.Errorf("%s: got %d vCPU and %d MiB, want %d vCPU and %d MiB", tt.instanceType, instance.VCpu, instance.Memory, tt.vcpu, tt.memory)
+		}
+	}
+}
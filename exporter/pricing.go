@@ -0,0 +1,165 @@
+package exporter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PricingProvider is the source of instance types and hourly prices for the configured region.
+// Providers only report raw prices, Metrics takes care of splitting them into vCPU and memory costs.
+type PricingProvider interface {
+	// Name identifies the provider in logs
+	Name() string
+
+	// Region is the region the prices are retrieved for
+	Region() string
+
+	// InstanceTypes returns the EC2 instance types available in the region keyed by instance type,
+	// only the hardware attributes (type, vCPU and memory) are populated
+	InstanceTypes(ctx context.Context) (map[string]*Instance, error)
+
+	// OnDemandPricing returns the hourly on-demand price of an operating system keyed by instance type
+	OnDemandPricing(ctx context.Context, operatingSystem string) (map[string]float64, error)
+
+	// SpotPricing returns the current hourly spot price of an operating system keyed by instance type and availability zone
+	SpotPricing(ctx context.Context, operatingSystem string) (map[string]map[string]float64, error)
+
+	// EKSPricing returns the hourly price of one vCPU and one GB of memory on Fargate and of the cluster control plane
+	EKSPricing(ctx context.Context) (*EKSPrices, error)
+
+	// VolumePricing returns the monthly price of each EBS volume type
+	VolumePricing(ctx context.Context) (map[string]*VolumePrice, error)
+
+	// LoadBalancerPricing returns the fixed hourly price keyed by load balancer type
+	LoadBalancerPricing(ctx context.Context) (map[string]float64, error)
+
+	// Fingerprint identifies the region and filters of the returned prices, it invalidates the pricing cache when changed
+	Fingerprint() string
+}
+
+// RefreshPricing retrieves the prices from the pricing provider, replaces the Instances map
+// and re-prices the existing nodes and pods, current prices are kept if it fails
+func (m *Metrics) RefreshPricing(ctx context.Context) error {
+	instances, err := m.GetInstances(ctx)
+	if err != nil {
+		m.pricingRefreshErrors.Inc()
+		m.setPricingHealth(err)
+		return err
+	}
+
+	fargate, controlPlane, err := m.GetEKSPricing(ctx)
+	if err != nil {
+		m.pricingRefreshErrors.Inc()
+		m.setPricingHealth(err)
+		return err
+	}
+	instances["fargate"] = fargate
+
+	volumes, err := m.GetVolumePricing(ctx)
+	if err != nil {
+		m.pricingRefreshErrors.Inc()
+		m.setPricingHealth(err)
+		return err
+	}
+
+	loadBalancers, err := m.GetLoadBalancerPricing(ctx)
+	if err != nil {
+		m.pricingRefreshErrors.Inc()
+		m.setPricingHealth(err)
+		return err
+	}
+
+	m.setVolumePrices(volumes)
+	m.setLoadBalancerPrices(loadBalancers)
+	m.setControlPlanePrice(controlPlane)
+	// set before the nodes are re-priced, missing prices are only reported once prices are loaded
+	m.setPricingHealth(nil)
+	m.setInstances(instances)
+
+	m.pricingLastRefresh.SetToCurrentTime()
+	log.Infof("Loaded pricing of %d instance types from %s", len(instances), m.pricing.Name())
+
+	if len(m.pricingCacheFile) > 0 {
+		if err := m.savePricingCache(pricingCache{Instances: instances, Volumes: volumes, LoadBalancers: loadBalancers, ControlPlane: controlPlane}); err != nil {
+			log.WithError(err).Warn("Failed to write pricing cache")
+		}
+	}
+
+	return nil
+}
+
+// setInstances replaces the Instances map and re-prices the existing nodes and pods
+func (m *Metrics) setInstances(instances map[string]*Instance) {
+	m.instancesMtx.Lock()
+	m.Instances = instances
+	for _, instance := range instances {
+		// e.g. cached prices of the operating systems of nodes seen before a restart
+		if instance.OS != "" {
+			m.operatingSystems[instance.OS] = struct{}{}
+		}
+	}
+	m.instancesMtx.Unlock()
+
+	m.nodesMtx.Lock()
+	m.repriceNodes()
+	m.nodesMtx.Unlock()
+
+	m.podsMtx.Lock()
+	m.nodesMtx.RLock()
+	for _, pod := range m.Pods {
+		m.updatePodCost(pod)
+	}
+	m.nodesMtx.RUnlock()
+	m.podsMtx.Unlock()
+}
+
+// nextPricingRefresh returns how long to wait for the next pricing refresh, false if there is none
+func (m *Metrics) nextPricingRefresh() (time.Duration, bool) {
+	if !m.Health().PricingLoaded {
+		// keep trying until prices are loaded, even if the periodic refresh is disabled
+		return pricingRetryInterval, true
+	}
+
+	return m.pricingRefreshInterval, m.pricingRefreshInterval > 0
+}
+
+// pricingFingerprint hashes the provider, region and product filters used to retrieve prices
+func pricingFingerprint(provider string, region string, f PricingFilters) string {
+	filters, _ := json.Marshal([]map[string]string{f.ec2(region, OSLinux), f.eks(region)})
+
+	sum := sha256.Sum256([]byte(provider + "/" + region + "/" + string(filters)))
+	return hex.EncodeToString(sum[:])
+}
+
+// refreshPricingLoop refreshes the prices after next, if periodic is set, or when the prices of
+// another operating system are requested
+func (m *Metrics) refreshPricingLoop(ctx context.Context, next time.Duration, periodic bool) {
+	for {
+		var timer <-chan time.Time
+		if periodic {
+			timer = time.After(next)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer:
+		case <-m.pricingRefresh:
+			log.Info("Refreshing pricing to load the operating systems of new nodes")
+		}
+
+		// the cluster may have been upgraded out of extended support
+		m.refreshClusterVersion()
+
+		if err := m.RefreshPricing(ctx); err != nil {
+			log.WithError(err).Error("Failed to refresh pricing, keeping current prices")
+		}
+
+		next, periodic = m.nextPricingRefresh()
+	}
+}
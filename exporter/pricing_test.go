@@ -0,0 +1,156 @@
+package exporter
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+// fakePricingProvider returns fixed prices, keyed by operating system
+type fakePricingProvider struct {
+	instances map[string]*Instance
+	onDemand  map[string]map[string]float64
+	spot      map[string]map[string]map[string]float64
+	eks       *EKSPrices
+}
+
+func (p *fakePricingProvider) Name() string {
+	return "fake"
+}
+
+func (p *fakePricingProvider) Region() string {
+	return "us-east-1"
+}
+
+func (p *fakePricingProvider) InstanceTypes(ctx context.Context) (map[string]*Instance, error) {
+	// callers modify the instances, like the ones of the real providers they must not be shared
+	instances := make(map[string]*Instance, len(p.instances))
+	for instanceType, instance := range p.instances {
+		clone := *instance
+		instances[instanceType] = &clone
+	}
+
+	return instances, nil
+}
+
+func (p *fakePricingProvider) OnDemandPricing(ctx context.Context, operatingSystem string) (map[string]float64, error) {
+	return p.onDemand[operatingSystem], nil
+}
+
+func (p *fakePricingProvider) SpotPricing(ctx context.Context, operatingSystem string) (map[string]map[string]float64, error) {
+	return p.spot[operatingSystem], nil
+}
+
+func (p *fakePricingProvider) EKSPricing(ctx context.Context) (*EKSPrices, error) {
+	return p.eks, nil
+}
+
+func (p *fakePricingProvider) VolumePricing(ctx context.Context) (map[string]*VolumePrice, error) {
+	return map[string]*VolumePrice{}, nil
+}
+
+func (p *fakePricingProvider) LoadBalancerPricing(ctx context.Context) (map[string]float64, error) {
+	return map[string]float64{}, nil
+}
+
+func (p *fakePricingProvider) Fingerprint() string {
+	return "fake"
+}
+
+// newTestMetrics returns a Metrics with the state NewMetrics sets up before connecting to the cluster
+func newTestMetrics(provider PricingProvider) *Metrics {
+	return &Metrics{
+		Instances:         make(map[string]*Instance),
+		Pods:              make(map[string]*Pod),
+		Nodes:             make(map[string]*Node),
+		missingSpotPrices: make(map[string]struct{}),
+		operatingSystems:  map[string]struct{}{OSLinux: {}},
+		pricingRefresh:    make(chan struct{}, 1),
+		pricing:           provider,
+	}
+}
+
+// almostEqual compares costs, they are the result of float divisions
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestGetInstances(t *testing.T) {
+	provider := &fakePricingProvider{
+		instances: map[string]*Instance{
+			"m5.large":  {Type: "m5.large", VCpu: 2, Memory: 8192},
+			"r5.xlarge": {Type: "r5.xlarge", VCpu: 4, Memory: 32768},
+		},
+		onDemand: map[string]map[string]float64{
+			OSLinux:   {"m5.large": 0.096, "r5.xlarge": 0.252, "unknown.large": 1},
+			OSWindows: {"m5.large": 0.188},
+		},
+		spot: map[string]map[string]map[string]float64{
+			OSLinux: {"m5.large": {"us-east-1a": 0.035}},
+		},
+	}
+
+	m := newTestMetrics(provider)
+	m.operatingSystems[OSWindows] = struct{}{}
+	instances, err := m.GetInstances(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key      string
+		os       string
+		onDemand float64
+		spot     map[string]float64
+	}{
+		{"m5.large", OSLinux, 0.096, map[string]float64{"us-east-1a": 0.035}},
+		{"r5.xlarge", OSLinux, 0.252, map[string]float64{}},
+		// r5.xlarge has no Windows price
+		{"m5.large/windows", OSWindows, 0.188, map[string]float64{}},
+	}
+
+	if len(instances) != len(tests) {
+		t.Fatalf("got instances %v, want %d", instances, len(tests))
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			instance, ok := instances[tt.key]
+			if !ok {
+				t.Fatalf("instance %s not found", tt.key)
+			}
+			if instance.OS != tt.os {
+				t.Errorf("got os %s, want %s", instance.OS, tt.os)
+			}
+
+			// the vCPUs and memory add up to the instance price
+			cost := instance.OnDemandCost
+			if total := cost.VCpu*float64(instance.VCpu) + cost.Memory*float64(instance.Memory)/1024; cost.Total != tt.onDemand || !almostEqual(total, tt.onDemand) {
+				t.Errorf("got on-demand cost %+v adding up to %v, want %v", cost, total, tt.onDemand)
+			}
+
+			if len(instance.SpotCost) != len(tt.spot) {
+				t.Fatalf("got spot costs %v, want %v", instance.SpotCost, tt.spot)
+			}
+			for az, price := range tt.spot {
+				if instance.SpotCost[az] == nil || instance.SpotCost[az].Total != price {
+					t.Errorf("got spot cost %+v in %s, want %v", instance.SpotCost[az], az, price)
+				}
+			}
+		})
+	}
+}
+
+func TestGetNormalizedCost(t *testing.T) {
+	vcpu, memory, gpu := getNormalizedCost(0.096, &Instance{VCpu: 2, Memory: 8192})
+
+	if want := 0.096 / (7.2*2 + 8); !almostEqual(memory, want) {
+		t.Errorf("got memory cost %v, want %v", memory, want)
+	}
+	if !almostEqual(vcpu, 7.2*memory) {
+		t.Errorf("got vCPU cost %v, want 7.2 times the memory cost %v", vcpu, memory)
+	}
+	if gpu != 0 {
+		t.Errorf("got GPU cost %v of an instance without GPUs, want 0", gpu)
+	}
+}
@@ -0,0 +1,122 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// UsageSourcePrometheus reads pod usage averaged over a window from a Prometheus compatible API
+	UsageSourcePrometheus = "prometheus"
+
+	// cadvisor also reports the pod cgroup, with an empty container, and the pause container
+	prometheusCpuQuery    = `sum by (namespace, pod) (rate(container_cpu_usage_seconds_total{container!="",container!="POD"}[%s]))`
+	prometheusMemoryQuery = `sum by (namespace, pod) (avg_over_time(container_memory_working_set_bytes{container!="",container!="POD"}[%s]))`
+)
+
+// PrometheusUsageSource reads the cadvisor metrics of the pods from Prometheus, averaging them over
+// a window so the cost reflects the consumption of the whole interval instead of a single sample
+type PrometheusUsageSource struct {
+	api    promv1.API
+	window time.Duration
+}
+
+// ValidateUsageWindow checks that window can be used as the range of the prometheus queries
+func ValidateUsageWindow(window time.Duration) error {
+	if window <= 0 {
+		return fmt.Errorf("usage window must be positive, got %s", window)
+	}
+
+	return nil
+}
+
+// NewPrometheusUsageSource creates a usage source querying the Prometheus API at address
+func NewPrometheusUsageSource(address string, window time.Duration) (*PrometheusUsageSource, error) {
+	if err := ValidateUsageWindow(window); err != nil {
+		return nil, err
+	}
+
+	client, err := api.NewClient(api.Config{Address: address})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PrometheusUsageSource{api: promv1.NewAPI(client), window: window}, nil
+}
+
+func (s *PrometheusUsageSource) Name() string {
+	return UsageSourcePrometheus
+}
+
+func (s *PrometheusUsageSource) PodUsage(ctx context.Context) (map[string]*PodResources, error) {
+	window := model.Duration(s.window).String()
+
+	cpu, err := s.query(ctx, fmt.Sprintf(prometheusCpuQuery, window))
+	if err != nil {
+		return nil, err
+	}
+
+	memory, err := s.query(ctx, fmt.Sprintf(prometheusMemoryQuery, window))
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[string]*PodResources, len(cpu))
+	get := func(key string) *PodResources {
+		resources, ok := usage[key]
+		if !ok {
+			resources = &PodResources{
+				Cpu:    resource.NewQuantity(0, resource.DecimalSI),
+				Memory: resource.NewQuantity(0, resource.BinarySI),
+			}
+			usage[key] = resources
+		}
+
+		return resources
+	}
+
+	for key, cores := range cpu {
+		get(key).Cpu.SetMilli(int64(cores * 1000))
+	}
+	for key, bytes := range memory {
+		get(key).Memory.Set(int64(bytes))
+	}
+
+	return usage, nil
+}
+
+// query runs an instant query returning the value of each series keyed by namespace/pod
+func (s *PrometheusUsageSource) query(ctx context.Context, query string) (map[string]float64, error) {
+	value, warnings, err := s.api.Query(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range warnings {
+		log.Warnf("Prometheus query warning: %s", warning)
+	}
+
+	vector, ok := value.(model.Vector)
+	if !ok {
+		return nil, fmt.Errorf("unexpected prometheus result type %s", value.Type())
+	}
+
+	result := make(map[string]float64, len(vector))
+	for _, sample := range vector {
+		namespace := string(sample.Metric["namespace"])
+		pod := string(sample.Metric["pod"])
+		if namespace == "" || pod == "" {
+			continue
+		}
+
+		result[namespace+"/"+pod] = float64(sample.Value)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,109 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusUsageSourcePodUsage(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		cpu     string
+		memory  string
+		want    map[string][2]int64
+		wantErr bool
+	}{
+		{
+			name:   "vector",
+			status: http.StatusOK,
+			cpu:    `[{"metric":{"namespace":"default","pod":"web"},"value":[1700000000,"0.25"]},{"metric":{"pod":"orphan"},"value":[1700000000,"1"]}]`,
+			memory: `[{"metric":{"namespace":"default","pod":"web"},"value":[1700000000,"134217728"]},{"metric":{"namespace":"jobs","pod":"batch"},"value":[1700000000,"1024"]}]`,
+			want: map[string][2]int64{
+				"default/web": {250, 134217728},
+				"jobs/batch":  {0, 1024},
+			},
+		},
+		{
+			name:   "empty vector",
+			status: http.StatusOK,
+			cpu:    `[]`,
+			memory: `[]`,
+			want:   map[string][2]int64{},
+		},
+		{
+			name:    "server error",
+			status:  http.StatusInternalServerError,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var queries []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query := r.FormValue("query")
+				queries = append(queries, query)
+
+				w.Header().Set("Content-Type", "application/json")
+				if tt.status != http.StatusOK {
+					w.WriteHeader(tt.status)
+					w.Write([]byte(`{"status":"error","errorType":"internal","error":"boom"}`))
+					return
+				}
+
+				result := tt.memory
+				if strings.Contains(query, "container_cpu_usage_seconds_total") {
+					result = tt.cpu
+				}
+				w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":` + result + `}}`))
+			}))
+			defer server.Close()
+
+			source, err := NewPrometheusUsageSource(server.URL, 10*time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			usage, err := source.PodUsage(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(queries) == 0 || !strings.Contains(queries[0], "[10m]") {
+				t.Errorf("queries %q do not use the usage window", queries)
+			}
+
+			if len(usage) != len(tt.want) {
+				t.Fatalf("got %d pods, want %d", len(usage), len(tt.want))
+			}
+			for key, want := range tt.want {
+				got, ok := usage[key]
+				if !ok {
+					t.Fatalf("pod %s not found", key)
+				}
+				if got.Cpu.MilliValue() != want[0] || got.Memory.Value() != want[1] {
+					t.Errorf("%s: got %dm cpu and %d memory, want %dm and %d", key, got.Cpu.MilliValue(), got.Memory.Value(), want[0], want[1])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateUsageWindow(t *testing.T) {
+	for window, valid := range map[time.Duration]bool{0: false, -time.Minute: false, time.Minute: true} {
+		if err := ValidateUsageWindow(window); (err == nil) != valid {
+			t.Errorf("%s: got %v", window, err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package exporter
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+)
+
+const (
+	// RatioStrategyConstant uses the same cpu/memory cost relation for every instance type
+	RatioStrategyConstant = "constant"
+	// RatioStrategyRegression derives the relation from the price of the c/m/r families of each generation
+	RatioStrategyRegression = "regression"
+	// ratioStrategyOverride is reported for the families with a configured relation
+	ratioStrategyOverride = "override"
+)
+
+var (
+	// e.g. m6i: category "m", generation "6i"; c7gn: category "c", generation "7gn"
+	familyRe = regexp.MustCompile(`^(?P<category>[a-z]+?)(?P<generation>[0-9][a-z0-9\-]*)$`)
+)
+
+// ValidateRatioStrategy checks that strategy is one of the supported cpu/memory ratio strategies
+func ValidateRatioStrategy(strategy string) error {
+	switch strategy {
+	case RatioStrategyConstant, RatioStrategyRegression:
+		return nil
+	}
+
+	return fmt.Errorf("unknown cpu/memory ratio strategy %q, must be %s or %s", strategy, RatioStrategyConstant, RatioStrategyRegression)
+}
+
+// ValidateRatio checks that ratio can split instance prices between vCPU and memory, a ratio of zero or
+// less would give memory all or more than the whole price
+func ValidateRatio(ratio float64) error {
+	if ratio <= 0 || math.IsNaN(ratio) || math.IsInf(ratio, 0) {
+		return fmt.Errorf("invalid cpu/memory ratio %v, must be a positive number", ratio)
+	}
+
+	return nil
+}
+
+// splitFamily returns the category and generation of an instance family
+func splitFamily(family string) (string, string) {
+	r := familyRe.FindStringSubmatch(family)
+	if r == nil {
+		return family, ""
+	}
+
+	return r[familyRe.SubexpIndex("category")], r[familyRe.SubexpIndex("generation")]
+}
+
+// setCpuMemRatios sets the relation between the cost of one vCPU and one GB of memory of each instance type
+func (m *Metrics) setCpuMemRatios(instances map[string]*Instance, onDemand map[string]float64) {
+	generations := map[string]float64{}
+	if m.cpuMemRatioStrategy == RatioStrategyRegression {
+		generations = regressionRatios(instances, onDemand)
+	}
+
+	for _, instance := range instances {
+		family := instanceFamily(instance.Type)
+		_, generation := splitFamily(family)
+
+		if ratio, ok := m.cpuMemRatioOverrides[family]; ok {
+			instance.CpuMemRatio = ratio
+			instance.CpuMemRatioStrategy = ratioStrategyOverride
+		} else if ratio, ok := generations[generation]; ok {
+			instance.CpuMemRatio = ratio
+			instance.CpuMemRatioStrategy = RatioStrategyRegression
+		} else {
+			instance.CpuMemRatio = m.cpuMemRatio
+			instance.CpuMemRatioStrategy = RatioStrategyConstant
+		}
+	}
+}
+
+// regressionRatios fits price = vcpuCost * vcpu + memoryCost * memory over the instances of each generation,
+// returning vcpuCost/memoryCost keyed by generation
+func regressionRatios(instances map[string]*Instance, onDemand map[string]float64) map[string]float64 {
+	generations := map[string]struct{}{}
+	for instanceType := range onDemand {
+		_, generation := splitFamily(instanceFamily(instanceType))
+		generations[generation] = struct{}{}
+	}
+
+	ratios := make(map[string]float64, len(generations))
+	for generation := range generations {
+		vcpuCost, memoryCost, ok := fitCpuMemRates(instances, onDemand, func(instanceType string) bool {
+			_, g := splitFamily(instanceFamily(instanceType))
+			return g == generation
+		})
+		if !ok {
+			// e.g. only one family of the generation is available in the region
+			continue
+		}
+
+		ratios[generation] = vcpuCost / memoryCost
+	}
+
+	return ratios
+}
+
+// fitCpuMemRates fits price = vcpuCost * vcpu + memoryCost * memory by least squares over the compute (c),
+// general purpose (m) and memory (r) optimized instances without GPUs selected by filter
+func fitCpuMemRates(instances map[string]*Instance, onDemand map[string]float64, filter func(instanceType string) bool) (float64, float64, bool) {
+	var vv, vg, gg, pv, pg float64
+	for instanceType, price := range onDemand {
+		instance, ok := instances[instanceType]
+		if !ok || price <= 0 || instance.Gpu > 0 || !filter(instanceType) {
+			continue
+		}
+
+		category, _ := splitFamily(instanceFamily(instanceType))
+		if category != "c" && category != "m" && category != "r" {
+			continue
+		}
+
+		vcpu := float64(instance.VCpu)
+		memory := float64(instance.Memory) / 1024
+		vv += vcpu * vcpu
+		vg += vcpu * memory
+		gg += memory * memory
+		pv += price * vcpu
+		pg += price * memory
+	}
+
+	return solveRegression(vv, vg, gg, pv, pg)
+}
+
+// solveRegression solves the least squares normal equations of price = a*vcpu + b*memory
+func solveRegression(vv, vg, gg, pv, pg float64) (float64, float64, bool) {
+	det := vv*gg - vg*vg
+	if math.Abs(det) < 1e-9*vv*gg {
+		return 0, 0, false
+	}
+
+	a := (pv*gg - pg*vg) / det
+	b := (pg*vv - pv*vg) / det
+	if a <= 0 || b <= 0 {
+		return 0, 0, false
+	}
+
+	return a, b, true
+}
@@ -0,0 +1,26 @@
+package exporter
+
+import (
+	"math"
+	"testing"
+)
+
+func TestValidateRatio(t *testing.T) {
+	tests := []struct {
+		ratio   float64
+		wantErr bool
+	}{
+		{DefaultCpuMemRelation, false},
+		{0.5, false},
+		{0, true},
+		{-1, true},
+		{math.NaN(), true},
+		{math.Inf(1), true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateRatio(tt.ratio); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateRatio(%v) error = %v, wantErr %v", tt.ratio, err, tt.wantErr)
+		}
+	}
+}
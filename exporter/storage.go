@@ -0,0 +1,361 @@
+package exporter
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// hoursPerMonth is how AWS converts monthly prices to hourly ones
+	hoursPerMonth = 730
+
+	ebsCSIDriver = "ebs.csi.aws.com"
+
+	// gp3 volumes include a baseline performance, only what is provisioned above it is charged
+	gp3BaselineIops       = 3000
+	gp3BaselineThroughput = 125
+)
+
+// VolumePrice is the monthly price of an EBS volume type
+type VolumePrice struct {
+	// Storage is the price of one GB
+	Storage float64
+	// Iops is the price of one provisioned IOPS
+	Iops float64
+	// Throughput is the price of one provisioned MiB/s
+	Throughput float64
+	Source     string
+}
+
+// Volume is an EBS backed PersistentVolume
+type Volume struct {
+	Name         string
+	StorageClass string
+	Type         string
+	// TypeInferred is set when the type is not in the storage class parameters, e.g. statically provisioned
+	// volumes or a deleted storage class, and the provisioner default was assumed
+	TypeInferred   bool
+	ClaimNamespace string
+	ClaimName      string
+	// Size in GiB
+	Size       float64
+	Iops       int64
+	Throughput int64
+	// Cost is the hourly cost of the volume
+	Cost float64
+}
+
+// ebsStorageFilters selects the price of the storage of each EBS volume type of a region in the AmazonEC2 price list,
+// the Local Zones and Outposts of the region are priced differently
+func ebsStorageFilters(region string) map[string]string {
+	return map[string]string{
+		"regionCode":    region,
+		"locationType":  "AWS Region",
+		"productFamily": "Storage",
+	}
+}
+
+// ebsIopsFilters selects the price of the provisioned IOPS of each EBS volume type of a region
+func ebsIopsFilters(region string) map[string]string {
+	return map[string]string{
+		"regionCode":    region,
+		"locationType":  "AWS Region",
+		"productFamily": "System Operation",
+		"group":         "EBS IOPS",
+	}
+}
+
+// ebsThroughputFilters selects the price of the provisioned throughput of each EBS volume type of a region
+func ebsThroughputFilters(region string) map[string]string {
+	return map[string]string{
+		"regionCode":    region,
+		"locationType":  "AWS Region",
+		"productFamily": "Provisioned Throughput",
+	}
+}
+
+// GetVolumePricing returns the monthly price of each EBS volume type
+func (m *Metrics) GetVolumePricing(ctx context.Context) (map[string]*VolumePrice, error) {
+	now := time.Now()
+	defer timeTrack(now, "Retrieving EBS pricing")
+
+	var prices map[string]*VolumePrice
+	err := retry(ctx, "Retrieving EBS pricing", func() (err error) {
+		prices, err = m.pricing.VolumePricing(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, price := range prices {
+		price.Storage, _ = m.overrides.apply("ebs", nil, price.Storage, m.pricing.Name())
+		price.Iops, _ = m.overrides.apply("ebs", nil, price.Iops, m.pricing.Name())
+		price.Throughput, price.Source = m.overrides.apply("ebs", nil, price.Throughput, m.pricing.Name())
+	}
+
+	return prices, nil
+}
+
+func (p *AWSPricingProvider) VolumePricing(ctx context.Context) (map[string]*VolumePrice, error) {
+	storage, err := p.getProducts(ctx, "AmazonEC2", ebsStorageFilters(p.config.Region))
+	if err != nil {
+		return nil, err
+	}
+
+	iops, err := p.getProducts(ctx, "AmazonEC2", ebsIopsFilters(p.config.Region))
+	if err != nil {
+		return nil, err
+	}
+
+	throughput, err := p.getProducts(ctx, "AmazonEC2", ebsThroughputFilters(p.config.Region))
+	if err != nil {
+		return nil, err
+	}
+
+	return volumePricing(storage, iops, throughput), nil
+}
+
+func volumePricing(storage, iops, throughput []Pricing) map[string]*VolumePrice {
+	prices := make(map[string]*VolumePrice)
+	get := func(product Pricing) *VolumePrice {
+		volumeType := product.Product.Attributes["volumeApiName"]
+		price, ok := prices[volumeType]
+		if !ok {
+			price = &VolumePrice{}
+			prices[volumeType] = price
+		}
+
+		return price
+	}
+
+	for _, product := range storage {
+		if product.Product.Attributes["volumeApiName"] == "" {
+			continue
+		}
+		get(product).Storage, _ = firstTierPrice(product)
+	}
+	for _, product := range iops {
+		if product.Product.Attributes["volumeApiName"] == "" {
+			continue
+		}
+		get(product).Iops, _ = firstTierPrice(product)
+	}
+	for _, product := range throughput {
+		if product.Product.Attributes["volumeApiName"] == "" {
+			continue
+		}
+
+		value, unit := firstTierPrice(product)
+		if strings.HasPrefix(unit, "GiBps") {
+			// throughput is provisioned in MiB/s
+			value = value / 1024
+		}
+		get(product).Throughput = value
+	}
+
+	return prices
+}
+
+// firstTierPrice returns the on-demand price and unit of the first tier of a product, e.g. io2 IOPS are
+// cheaper above 32000 but most volumes are below it. Products with a single price dimension are not tiered.
+func firstTierPrice(product Pricing) (float64, string) {
+	var dimensions []Details
+	for _, term := range product.Terms.OnDemand {
+		for _, details := range term.PriceDimensions {
+			dimensions = append(dimensions, details)
+		}
+	}
+
+	for _, details := range dimensions {
+		if details.BeginRange == "0" || len(dimensions) == 1 {
+			value, _ := strconv.ParseFloat(details.PricePerUnit["USD"], 64)
+			return value, details.Unit
+		}
+	}
+
+	return 0, ""
+}
+
+// setVolumePrices replaces the EBS prices
+func (m *Metrics) setVolumePrices(prices map[string]*VolumePrice) {
+	m.instancesMtx.Lock()
+	defer m.instancesMtx.Unlock()
+
+	m.volumePrices = prices
+}
+
+// GetVolumes caches the PersistentVolumes, their claims and storage classes
+func (m *Metrics) GetVolumes(ctx context.Context) {
+	now := time.Now()
+	defer timeTrack(now, "Retrieving current PersistentVolume list")
+
+	pvInformer := m.informers.Core().V1().PersistentVolumes()
+	pvcInformer := m.informers.Core().V1().PersistentVolumeClaims()
+	scInformer := m.informers.Storage().V1().StorageClasses()
+	m.persistentVolumes = pvInformer.Lister()
+	m.persistentVolumeClaims = pvcInformer.Lister()
+	m.storageClasses = scInformer.Lister()
+
+	m.informers.Start(ctx.Done())
+	cache.WaitForCacheSync(ctx.Done(), pvInformer.Informer().HasSynced, pvcInformer.Informer().HasSynced, scInformer.Informer().HasSynced)
+}
+
+// newVolume resolves the type, size and provisioned performance of a PersistentVolume from its
+// storage class, nil if it is not an EBS volume
+func (m *Metrics) newVolume(pv *corev1.PersistentVolume) *Volume {
+	var volumeType string
+	switch {
+	case pv.Spec.CSI != nil && pv.Spec.CSI.Driver == ebsCSIDriver:
+		volumeType = "gp3"
+	case pv.Spec.AWSElasticBlockStore != nil:
+		// in-tree provisioner default
+		volumeType = "gp2"
+	default:
+		return nil
+	}
+
+	storage := pv.Spec.Capacity[corev1.ResourceStorage]
+	volume := &Volume{
+		Name:         pv.ObjectMeta.Name,
+		StorageClass: pv.Spec.StorageClassName,
+		Size:         float64(storage.Value()) / 1024 / 1024 / 1024,
+	}
+	if pv.Spec.ClaimRef != nil {
+		volume.ClaimNamespace = pv.Spec.ClaimRef.Namespace
+		volume.ClaimName = pv.Spec.ClaimRef.Name
+	}
+
+	parameters := map[string]string{}
+	if sc, err := m.storageClasses.Get(pv.Spec.StorageClassName); err == nil {
+		for key, value := range sc.Parameters {
+			// parameter keys are case insensitive
+			parameters[strings.ToLower(key)] = value
+		}
+	}
+
+	if t, ok := parameters["type"]; ok {
+		volumeType = strings.ToLower(t)
+	} else {
+		log.Debugf("Type of PersistentVolume %s not found in its storage class %q, assuming %s", pv.ObjectMeta.Name, pv.Spec.StorageClassName, volumeType)
+		volume.TypeInferred = true
+	}
+	volume.Type = volumeType
+
+	if iops, err := strconv.ParseInt(parameters["iops"], 10, 64); err == nil {
+		volume.Iops = iops
+	} else if iopsPerGB, err := strconv.ParseFloat(parameters["iopspergb"], 64); err == nil {
+		volume.Iops = int64(iopsPerGB * volume.Size)
+	}
+	if throughput, err := strconv.ParseInt(parameters["throughput"], 10, 64); err == nil {
+		volume.Throughput = throughput
+	}
+
+	if volume.Type == "gp3" {
+		if volume.Iops < gp3BaselineIops {
+			volume.Iops = gp3BaselineIops
+		}
+		if volume.Throughput < gp3BaselineThroughput {
+			volume.Throughput = gp3BaselineThroughput
+		}
+	}
+
+	return volume
+}
+
+// priceVolume sets the hourly cost of a volume, only the performance provisioned above the gp3 baseline is charged
+func (m *Metrics) priceVolume(volume *Volume) {
+	m.instancesMtx.RLock()
+	price, ok := m.volumePrices[volume.Type]
+	m.instancesMtx.RUnlock()
+	if !ok {
+		log.Debugf("Price of %s volumes not found", volume.Type)
+		volume.Cost = 0
+		return
+	}
+
+	iops := volume.Iops
+	throughput := volume.Throughput
+	switch volume.Type {
+	case "gp3":
+		iops = iops - gp3BaselineIops
+		throughput = throughput - gp3BaselineThroughput
+	case "io1", "io2":
+		throughput = 0
+	default:
+		iops = 0
+		throughput = 0
+	}
+
+	monthly := volume.Size*price.Storage + float64(iops)*price.Iops + float64(throughput)*price.Throughput
+	volume.Cost = monthly / hoursPerMonth
+}
+
+// updateStorageCost prices the EBS volumes and splits the cost of each volume between the pods mounting
+// its claim, caller must hold the pods lock
+func (m *Metrics) updateStorageCost() []*Volume {
+	pvs, err := m.persistentVolumes.List(labels.Everything())
+	if err != nil {
+		log.WithError(err).Warn("Failed to list PersistentVolumes")
+		return nil
+	}
+
+	volumes := make([]*Volume, 0, len(pvs))
+	claims := make(map[string]*Volume)
+	for _, pv := range pvs {
+		volume := m.newVolume(pv)
+		if volume == nil {
+			continue
+		}
+
+		m.priceVolume(volume)
+		volumes = append(volumes, volume)
+
+		if volume.ClaimName == "" {
+			continue
+		}
+
+		// the claim may have been deleted and recreated, it must still be bound to this volume
+		pvc, err := m.persistentVolumeClaims.PersistentVolumeClaims(volume.ClaimNamespace).Get(volume.ClaimName)
+		if err == nil && pvc.Spec.VolumeName == volume.Name {
+			claims[volume.ClaimNamespace+"/"+volume.ClaimName] = volume
+		}
+	}
+
+	mounts := make(map[string]int)
+	for _, pod := range m.Pods {
+		for _, claim := range pod.Claims {
+			mounts[pod.Namespace+"/"+claim]++
+		}
+	}
+
+	for _, pod := range m.Pods {
+		pod.StorageCost = 0
+		for _, claim := range pod.Claims {
+			if volume, ok := claims[pod.Namespace+"/"+claim]; ok {
+				pod.StorageCost += volume.Cost / float64(mounts[pod.Namespace+"/"+claim])
+			}
+		}
+	}
+
+	return volumes
+}
+
+// podClaims returns the PersistentVolumeClaims mounted by a pod
+func podClaims(pod *corev1.Pod) []string {
+	claims := []string{}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			claims = append(claims, volume.PersistentVolumeClaim.ClaimName)
+		}
+	}
+
+	return claims
+}
@@ -0,0 +1,145 @@
+package exporter
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	storagelisters "k8s.io/client-go/listers/storage/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// tieredProduct returns a price list product of a volume type with one price dimension per price,
+// the tiers begin at 0, 32000 and 64000
+func tieredProduct(volumeType string, unit string, prices ...string) Pricing {
+	dimensions := map[string]Details{}
+	begins := []string{"0", "32000", "64000"}
+	for i, price := range prices {
+		dimensions[begins[i]] = Details{Unit: unit, BeginRange: begins[i], PricePerUnit: map[string]string{"USD": price}}
+	}
+
+	return Pricing{
+		Product: Product{Attributes: map[string]string{"volumeApiName": volumeType}},
+		Terms:   Terms{OnDemand: map[string]SKU{"term": {PriceDimensions: dimensions}}},
+	}
+}
+
+func TestVolumePricing(t *testing.T) {
+	storage := []Pricing{tieredProduct("gp3", "GB-Mo", "0.08"), tieredProduct("io2", "GB-Mo", "0.125"), tieredProduct("", "GB-Mo", "1")}
+	iops := []Pricing{tieredProduct("gp3", "IOPS-Mo", "0.005"), tieredProduct("io2", "IOPS-Mo", "0.065", "0.0455", "0.03185")}
+	throughput := []Pricing{tieredProduct("gp3", "GiBps-mo", "40.96")}
+
+	prices := volumePricing(storage, iops, throughput)
+
+	tests := []struct {
+		volumeType string
+		want       VolumePrice
+	}{
+		{"gp3", VolumePrice{Storage: 0.08, Iops: 0.005, Throughput: 0.04}},
+		// the first IOPS tier
+		{"io2", VolumePrice{Storage: 0.125, Iops: 0.065}},
+	}
+
+	if len(prices) != len(tests) {
+		t.Fatalf("got prices of %d volume types, want %d", len(prices), len(tests))
+	}
+	for _, tt := range tests {
+		t.Run(tt.volumeType, func(t *testing.T) {
+			got := prices[tt.volumeType]
+			if got == nil || !almostEqual(got.Storage, tt.want.Storage) || !almostEqual(got.Iops, tt.want.Iops) || !almostEqual(got.Throughput, tt.want.Throughput) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriceVolume(t *testing.T) {
+	m := newTestMetrics(&fakePricingProvider{})
+	m.volumePrices = map[string]*VolumePrice{
+		"gp3": {Storage: 0.08, Iops: 0.005, Throughput: 0.04},
+		"gp2": {Storage: 0.1},
+		"io2": {Storage: 0.125, Iops: 0.065},
+	}
+
+	tests := []struct {
+		name   string
+		volume *Volume
+		want   float64
+	}{
+		{"gp3 baseline", &Volume{Type: "gp3", Size: 100, Iops: gp3BaselineIops, Throughput: gp3BaselineThroughput}, 100 * 0.08},
+		{"gp3 provisioned", &Volume{Type: "gp3", Size: 100, Iops: 4000, Throughput: 250}, 100*0.08 + 1000*0.005 + 125*0.04},
+		{"gp2", &Volume{Type: "gp2", Size: 100, Iops: 300}, 100 * 0.1},
+		{"io2", &Volume{Type: "io2", Size: 100, Iops: 1000, Throughput: 500}, 100*0.125 + 1000*0.065},
+		{"unknown type", &Volume{Type: "st1", Size: 100}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m.priceVolume(tt.volume)
+			if want := tt.want / hoursPerMonth; !almostEqual(tt.volume.Cost, want) {
+				t.Errorf("got %v, want %v", tt.volume.Cost, want)
+			}
+		})
+	}
+}
+
+func TestNewVolume(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	indexer.Add(&storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "io2"},
+		Parameters: map[string]string{"type": "io2", "iopsPerGB": "50"},
+	})
+	indexer.Add(&storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Parameters: map[string]string{"fsType": "ext4"},
+	})
+
+	m := newTestMetrics(&fakePricingProvider{})
+	m.storageClasses = storagelisters.NewStorageClassLister(indexer)
+
+	newPV := func(storageClass string, source corev1.PersistentVolumeSource) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv"},
+			Spec: corev1.PersistentVolumeSpec{
+				StorageClassName:       storageClass,
+				Capacity:               corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("20Gi")},
+				PersistentVolumeSource: source,
+			},
+		}
+	}
+	csi := corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{Driver: ebsCSIDriver}}
+	inTree := corev1.PersistentVolumeSource{AWSElasticBlockStore: &corev1.AWSElasticBlockStoreVolumeSource{}}
+
+	tests := []struct {
+		name     string
+		pv       *corev1.PersistentVolume
+		want     *Volume
+		inferred bool
+	}{
+		{"storage class type", newPV("io2", csi), &Volume{Type: "io2", Size: 20, Iops: 1000}, false},
+		{"csi driver default", newPV("default", csi), &Volume{Type: "gp3", Size: 20, Iops: gp3BaselineIops, Throughput: gp3BaselineThroughput}, true},
+		{"in-tree default of a deleted storage class", newPV("deleted", inTree), &Volume{Type: "gp2", Size: 20}, true},
+		{"not an EBS volume", newPV("efs", corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{Driver: "efs.csi.aws.com"}}), nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := m.newVolume(tt.pv)
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("got %+v, want no volume", got)
+				}
+				return
+			}
+
+			if got == nil || got.Type != tt.want.Type || got.Size != tt.want.Size || got.Iops != tt.want.Iops || got.Throughput != tt.want.Throughput {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if got != nil && got.TypeInferred != tt.inferred {
+				t.Errorf("got type inferred %v, want %v", got.TypeInferred, tt.inferred)
+			}
+		})
+	}
+}
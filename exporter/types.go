@@ -2,34 +2,162 @@ package exporter
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	storagelisters "k8s.io/client-go/listers/storage/v1"
 	"k8s.io/client-go/rest"
 	metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
 )
 
+// Options configures the behaviour of Metrics
+type Options struct {
+	// PodLabels is the list of pod labels added to the pod metrics
+	PodLabels []string
+	// NodeLabels is the list of node labels added to the node metrics
+	NodeLabels []string
+	// NamespaceLabels is the list of namespace labels added to the namespace metrics
+	NamespaceLabels []string
+	// NamespaceAnnotations is the list of namespace annotations added to the namespace metrics
+	NamespaceAnnotations []string
+	// PricingRefreshInterval is how often prices are retrieved again from the pricing provider, zero disables it
+	PricingRefreshInterval time.Duration
+	// PricingCacheFile is where the resolved prices are persisted between restarts, empty disables the cache
+	PricingCacheFile string
+	// PricingCacheTTL is how long cached prices are considered fresh
+	PricingCacheTTL time.Duration
+	// Commitments are the savings plans and reserved instances applied to on-demand nodes, nil if there are none
+	Commitments *Commitments
+	// Overrides adjust the prices retrieved from the pricing provider, nil if there are none
+	Overrides *PricingOverrides
+	// CpuMemRatioStrategy selects how instance prices are split between vCPU and memory: constant or regression
+	CpuMemRatioStrategy string
+	// CpuMemRatio is the cost relation between one vCPU and one GB of memory used by the constant strategy
+	// and by the regression strategy when there are not enough instances to derive it
+	CpuMemRatio float64
+	// CpuMemRatioOverrides sets the cost relation of instance families, regardless of the strategy
+	CpuMemRatioOverrides map[string]float64
+	// AccountingInterval is how often the hourly costs are integrated into the spent counters
+	AccountingInterval time.Duration
+	// StateFile is where the spent counters are persisted between restarts, empty disables it
+	StateFile string
+	// ComputeInterval is how often usage is refreshed and costs are computed, 0 computes them only once
+	ComputeInterval time.Duration
+	// UsageSource selects where pod usage is read from: auto, metrics-server, kubelet or requests
+	UsageSource string
+	// PrometheusURL is the address of the Prometheus compatible API used by the prometheus usage source
+	PrometheusURL string
+	// UsageWindow is the window the prometheus usage source averages usage over
+	UsageWindow time.Duration
+	// IdleAllocation selects how the node idle cost is redistributed to its pods: none, requests, usage or max
+	IdleAllocation string
+	// ControlPlaneSupport selects the control plane price: standard or extended support, or auto to
+	// select it from the cluster version
+	ControlPlaneSupport string
+	// ControlPlaneAllocation selects how the control plane cost is distributed to the namespaces: none or compute
+	ControlPlaneAllocation string
+}
+
 type Metrics struct {
-	Instances map[string]*Instance
-	Pods      map[string]*Pod
-	Nodes     map[string]*Node
-	Metrics   map[string]*prometheus.CounterVec
-
-	awsconfig   aws.Config
-	config      *rest.Config
-	kubernetes  *kubernetes.Clientset
-	metrics     *metricsv.Clientset
-	podsMtx     sync.RWMutex
-	podsChan    chan struct{}
-	podsCached  bool
+	Instances  map[string]*Instance
+	Pods       map[string]*Pod
+	Nodes      map[string]*Node
+	Namespaces map[string]*Namespace
+	Metrics    map[string]*prometheus.CounterVec
+
+	pricing      PricingProvider
+	instancesMtx sync.RWMutex
+	volumePrices map[string]*VolumePrice
+	// loadBalancerPrices is the hourly price keyed by load balancer type
+	loadBalancerPrices map[string]float64
+	// operatingSystems are the operating systems prices are loaded for
+	operatingSystems map[string]struct{}
+	// pricingRefresh requests a pricing refresh before the next periodic one
+	pricingRefresh    chan struct{}
+	controlPlanePrice *ControlPlanePrice
+	// clusterSupport is the support tier of the cluster Kubernetes version, empty if unknown
+	clusterSupport         string
+	config                 *rest.Config
+	kubernetes             *kubernetes.Clientset
+	metrics                *metricsv.Clientset
+	usageSource            string
+	usage                  UsageSource
+	prometheusURL          string
+	usageWindow            time.Duration
+	informers              informers.SharedInformerFactory
+	persistentVolumes      corelisters.PersistentVolumeLister
+	persistentVolumeClaims corelisters.PersistentVolumeClaimLister
+	storageClasses         storagelisters.StorageClassLister
+	services               corelisters.ServiceLister
+	ingresses              networkinglisters.IngressLister
+	ingressClasses         networkinglisters.IngressClassLister
+	podsMtx                sync.RWMutex
+	// podsCached and nodesCached are set once the informers completed their initial list
+	podsCached atomic.Bool
+	podsAdded  int64
+	// nodesMtx also guards the fields of the nodes pods point to, pod code must hold it to read them
 	nodesMtx    sync.RWMutex
-	nodesChan   chan struct{}
-	nodesCached bool
+	nodesCached atomic.Bool
+	nodesAdded  int64
+	// missingSpotPrices are the instance types and zones already warned about not having a spot price,
+	// guarded by nodesMtx
+	missingSpotPrices map[string]struct{}
+	replicaSets       appslisters.ReplicaSetLister
+	jobs              batchlisters.JobLister
+	namespacesMtx     sync.RWMutex
+	namespacesAdded   int64
+
+	// settingsMtx guards the settings reloaded from the config file, they are also only
+	// changed while holding the pods and nodes locks so readers holding them do not need it
+	settingsMtx             sync.RWMutex
+	addPodLabels            []string
+	addNodeLabels           []string
+	addNamespaceLabels      []string
+	addNamespaceAnnotations []string
+
+	pricingRefreshInterval time.Duration
+	pricingCacheFile       string
+	pricingCacheTTL        time.Duration
+	commitments            *Commitments
+	overrides              *PricingOverrides
+	cpuMemRatioStrategy    string
+	cpuMemRatio            float64
+	cpuMemRatioOverrides   map[string]float64
+	idleAllocation         string
+	controlPlaneSupport    string
+	controlPlaneAllocation string
+	pricingLastRefresh     prometheus.Gauge
+	pricingRefreshErrors   prometheus.Counter
+	scrapeErrors           *prometheus.CounterVec
 
-	addPodLabels  []string
-	addNodeLabels []string
+	healthMtx sync.RWMutex
+	health    HealthStatus
+
+	computeInterval time.Duration
+	lastCompute     prometheus.Gauge
+	computeDuration prometheus.Histogram
+	snapshotMtx     sync.RWMutex
+	snapshot        []prometheus.Metric
+
+	accountingInterval time.Duration
+	stateFile          string
+	spentMtx           sync.Mutex
+	lastAccounting     time.Time
+	podSpent           map[string]float64
+	nodeSpent          map[string]float64
+	finishedPods       map[types.UID]struct{}
+	finishedNamespaces map[string]float64
+	finishedJobs       map[string]float64
 }
 
 type Ec2Cost struct {
@@ -37,41 +165,81 @@ type Ec2Cost struct {
 	Total  float64
 	VCpu   float64
 	Memory float64
+	Gpu    float64
+	// Source is where the price came from, e.g. the pricing provider or an override
+	Source string
 }
 
 type Instance struct {
 	//Kind string
-	Type         string
-	VCpu         int32
-	Memory       int64
-	OnDemandCost *Ec2Cost
-	SpotCost     map[string]*Ec2Cost
+	Type string
+	// OS is the operating system the instance is priced for, license included
+	OS     string
+	VCpu   int32
+	Memory int64
+	Gpu    int32
+	// GpuModel is the manufacturer and name of the GPUs, e.g. NVIDIA T4, the price list does not have it
+	GpuModel string
+	// OnDemandPrice is the hourly on-demand price of the pricing provider, before the overrides
+	OnDemandPrice float64
+	OnDemandCost  *Ec2Cost
+	SpotCost      map[string]*Ec2Cost
+	// CpuMemRatio is how many times one vCPU costs more than one GB of memory
+	CpuMemRatio float64
+	// CpuMemRatioStrategy is how CpuMemRatio was chosen: constant, regression or override
+	CpuMemRatioStrategy string
+	// GpuShare is the fraction of the instance price that pays for its GPUs
+	GpuShare float64
 }
 
 type Pod struct {
-	Name               string
-	Namespace          string
-	Labels             map[string]string
-	Resources          *PodResources
-	Node               *Node
-	Usage              *PodResources
+	Name      string
+	Namespace string
+	Labels    map[string]string
+	Owners    []metav1.OwnerReference
+	Resources *PodResources
+	Node      *Node
+	Usage     *PodResources
+	// UsageTime is when Usage was last reported by the usage source
+	UsageTime          time.Time
 	Cost               float64
 	VCpuCost           float64
 	MemoryCost         float64
 	VCpuRequestsCost   float64
 	MemoryRequestsCost float64
+	GpuCost            float64
+	// TotalWithIdle is the pod cost plus its share of the node idle cost
+	TotalWithIdle float64
+	// Claims are the PersistentVolumeClaims mounted by the pod
+	Claims []string
+	// StorageCost is the pod share of the cost of the EBS volumes it mounts
+	StorageCost float64
 }
 
 type Node struct {
-	Name     string
-	Labels   map[string]string
-	AZ       string
-	Region   string
+	Name      string
+	Labels    map[string]string
+	AZ        string
+	Region    string
+	Lifecycle string
+	// OS is the operating system the node is billed for: linux, windows, rhel or suse
+	OS       string
 	Instance *Instance
 	Cost     *Ec2Cost
+	// Capacity is the amount of resources provisioned for the node, only known for fargate nodes
+	Capacity *PodResources
+	// IdleCost is the cost of the node resources not attributed to any pod
+	IdleCost *Ec2Cost
+}
+
+type Namespace struct {
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
 }
 
 type PodResources struct {
 	Cpu    *resource.Quantity
 	Memory *resource.Quantity
+	Gpu    *resource.Quantity
 }
@@ -0,0 +1,318 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+const (
+	// UsageSourceAuto uses the first usage source that works: prometheus (if configured), metrics-server, kubelet and then requests
+	UsageSourceAuto = "auto"
+	// UsageSourceMetricsServer reads pod usage from the metrics.k8s.io API
+	UsageSourceMetricsServer = "metrics-server"
+	// UsageSourceKubelet reads pod usage from the kubelet summary API of each node through the API server proxy
+	UsageSourceKubelet = "kubelet"
+	// UsageSourceRequests does not read usage, pods are charged for their requests only
+	UsageSourceRequests = "requests"
+
+	// kubeletConcurrency bounds the concurrent requests to the kubelets
+	kubeletConcurrency = 10
+
+	// usageMaxAge is how long pods missing from the usage source keep their last known usage
+	usageMaxAge = 5 * time.Minute
+
+	// usageTimeout bounds the usage source queries when costs are computed only once
+	usageTimeout = 30 * time.Second
+)
+
+// UsageSource retrieves the current cpu and memory usage of the pods
+type UsageSource interface {
+	Name() string
+	// PodUsage returns the usage of the pods keyed by namespace/name, pods without usage are not included
+	PodUsage(ctx context.Context) (map[string]*PodResources, error)
+}
+
+// ValidateUsageSource checks that source is one of the supported usage sources
+func ValidateUsageSource(source string) error {
+	switch source {
+	case UsageSourceAuto, UsageSourceMetricsServer, UsageSourceKubelet, UsageSourceRequests, UsageSourcePrometheus:
+		return nil
+	}
+
+	return fmt.Errorf("unknown usage source %q, must be %s, %s, %s, %s or %s", source,
+		UsageSourceAuto, UsageSourceMetricsServer, UsageSourceKubelet, UsageSourceRequests, UsageSourcePrometheus)
+}
+
+// newUsageSource builds the usage source selected by name, in auto mode prometheus is tried first when configured.
+// Errors of each source are counted under its own name, also when it is one of the sources of auto mode
+func (m *Metrics) newUsageSource(name string) (UsageSource, error) {
+	metricsServer := m.countUsageErrors(&MetricsServerUsageSource{client: m.metrics})
+	kubelet := m.countUsageErrors(&KubeletUsageSource{
+		client:     m.kubernetes,
+		nodes:      m.kubeletNodes,
+		nodeErrors: m.scrapeErrors.WithLabelValues(UsageSourceKubelet),
+	})
+	requests := &RequestsUsageSource{}
+
+	var prom UsageSource
+	if len(m.prometheusURL) > 0 {
+		p, err := NewPrometheusUsageSource(m.prometheusURL, m.usageWindow)
+		if err != nil {
+			return nil, err
+		}
+		prom = m.countUsageErrors(p)
+	}
+
+	switch name {
+	case UsageSourceMetricsServer:
+		return metricsServer, nil
+	case UsageSourceKubelet:
+		return kubelet, nil
+	case UsageSourceRequests:
+		return requests, nil
+	case UsageSourcePrometheus:
+		if prom == nil {
+			return nil, fmt.Errorf("usage source %s requires the prometheus address", UsageSourcePrometheus)
+		}
+		return prom, nil
+	}
+
+	sources := []UsageSource{metricsServer, kubelet, requests}
+	if prom != nil {
+		sources = append([]UsageSource{prom}, sources...)
+	}
+
+	return &FallbackUsageSource{sources: sources}, nil
+}
+
+func (m *Metrics) countUsageErrors(source UsageSource) UsageSource {
+	return &countedUsageSource{UsageSource: source, errors: m.scrapeErrors.WithLabelValues(source.Name())}
+}
+
+// countedUsageSource counts the failures of the wrapped source
+type countedUsageSource struct {
+	UsageSource
+	errors prometheus.Counter
+}
+
+func (s *countedUsageSource) PodUsage(ctx context.Context) (map[string]*PodResources, error) {
+	usage, err := s.UsageSource.PodUsage(ctx)
+	if err != nil {
+		s.errors.Inc()
+	}
+
+	return usage, err
+}
+
+// kubeletNodes returns the nodes with a kubelet reachable through the API server, fargate nodes are excluded
+func (m *Metrics) kubeletNodes() []string {
+	m.nodesMtx.RLock()
+	defer m.nodesMtx.RUnlock()
+
+	nodes := make([]string, 0, len(m.Nodes))
+	for name, node := range m.Nodes {
+		if node.Lifecycle == "fargate" {
+			continue
+		}
+		nodes = append(nodes, name)
+	}
+
+	return nodes
+}
+
+// MetricsServerUsageSource reads pod usage from metrics-server
+type MetricsServerUsageSource struct {
+	client *metricsv.Clientset
+}
+
+func (s *MetricsServerUsageSource) Name() string {
+	return UsageSourceMetricsServer
+}
+
+func (s *MetricsServerUsageSource) PodUsage(ctx context.Context) (map[string]*PodResources, error) {
+	podMetricsList, err := s.client.MetricsV1beta1().PodMetricses("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[string]*PodResources, len(podMetricsList.Items))
+	for _, pod := range podMetricsList.Items {
+		resources := &PodResources{
+			Cpu:    resource.NewQuantity(0, resource.DecimalSI),
+			Memory: resource.NewQuantity(0, resource.BinarySI),
+		}
+
+		for _, container := range pod.Containers {
+			resources.Cpu.Add(container.Usage["cpu"])
+			resources.Memory.Add(container.Usage["memory"])
+		}
+
+		usage[pod.GetNamespace()+"/"+pod.GetName()] = resources
+	}
+
+	return usage, nil
+}
+
+// kubeletSummary is the subset of the kubelet /stats/summary response used by the exporter
+type kubeletSummary struct {
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		CPU *struct {
+			UsageNanoCores *uint64 `json:"usageNanoCores"`
+		} `json:"cpu"`
+		Memory *struct {
+			WorkingSetBytes *uint64 `json:"workingSetBytes"`
+		} `json:"memory"`
+	} `json:"pods"`
+}
+
+// KubeletUsageSource reads pod usage from the kubelet summary API, the same data metrics-server scrapes
+type KubeletUsageSource struct {
+	client *kubernetes.Clientset
+	nodes  func() []string
+	// nodeErrors counts the nodes whose summary could not be read when other nodes succeeded
+	nodeErrors prometheus.Counter
+}
+
+func (s *KubeletUsageSource) Name() string {
+	return UsageSourceKubelet
+}
+
+func (s *KubeletUsageSource) PodUsage(ctx context.Context) (map[string]*PodResources, error) {
+	nodes := s.nodes()
+
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	var lastErr error
+	failed := 0
+	usage := make(map[string]*PodResources)
+
+	sem := make(chan struct{}, kubeletConcurrency)
+	for _, node := range nodes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(node string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			pods, err := s.nodeUsage(ctx, node)
+
+			mtx.Lock()
+			defer mtx.Unlock()
+			if err != nil {
+				log.WithError(err).Debugf("Failed to read kubelet summary of %s", node)
+				lastErr = err
+				failed++
+				return
+			}
+
+			for key, resources := range pods {
+				usage[key] = resources
+			}
+		}(node)
+	}
+	wg.Wait()
+
+	if len(nodes) > 0 && failed == len(nodes) {
+		return nil, fmt.Errorf("could not read the kubelet summary of any node: %w", lastErr)
+	}
+	if failed > 0 {
+		log.WithError(lastErr).Warnf("Failed to read the kubelet summary of %d of %d nodes, their pods keep their last known usage", failed, len(nodes))
+		if s.nodeErrors != nil {
+			s.nodeErrors.Add(float64(failed))
+		}
+	}
+
+	return usage, nil
+}
+
+func (s *KubeletUsageSource) nodeUsage(ctx context.Context, node string) (map[string]*PodResources, error) {
+	data, err := s.client.CoreV1().RESTClient().Get().
+		Resource("nodes").
+		Name(node).
+		SubResource("proxy").
+		Suffix("stats/summary").
+		DoRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var summary kubeletSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, err
+	}
+
+	usage := make(map[string]*PodResources, len(summary.Pods))
+	for _, pod := range summary.Pods {
+		resources := &PodResources{
+			Cpu:    resource.NewQuantity(0, resource.DecimalSI),
+			Memory: resource.NewQuantity(0, resource.BinarySI),
+		}
+
+		if pod.CPU != nil && pod.CPU.UsageNanoCores != nil {
+			resources.Cpu = resource.NewScaledQuantity(int64(*pod.CPU.UsageNanoCores), resource.Nano)
+		}
+		if pod.Memory != nil && pod.Memory.WorkingSetBytes != nil {
+			resources.Memory = resource.NewQuantity(int64(*pod.Memory.WorkingSetBytes), resource.BinarySI)
+		}
+
+		usage[pod.PodRef.Namespace+"/"+pod.PodRef.Name] = resources
+	}
+
+	return usage, nil
+}
+
+// RequestsUsageSource reports no usage, so pods are charged for their requests
+type RequestsUsageSource struct{}
+
+func (s *RequestsUsageSource) Name() string {
+	return UsageSourceRequests
+}
+
+func (s *RequestsUsageSource) PodUsage(ctx context.Context) (map[string]*PodResources, error) {
+	return map[string]*PodResources{}, nil
+}
+
+// FallbackUsageSource returns the usage of the first source that succeeds
+type FallbackUsageSource struct {
+	sources []UsageSource
+	active  string
+}
+
+func (s *FallbackUsageSource) Name() string {
+	return UsageSourceAuto
+}
+
+func (s *FallbackUsageSource) PodUsage(ctx context.Context) (map[string]*PodResources, error) {
+	var lastErr error
+	for _, source := range s.sources {
+		usage, err := source.PodUsage(ctx)
+		if err != nil {
+			log.WithError(err).Debugf("Usage source %s failed", source.Name())
+			lastErr = err
+			continue
+		}
+
+		if s.active != source.Name() {
+			log.Infof("Using %s as pod usage source", source.Name())
+			s.active = source.Name()
+		}
+
+		return usage, nil
+	}
+
+	return nil, lastErr
+}
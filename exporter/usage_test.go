@@ -0,0 +1,176 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// fakeUsageSource reports a fixed usage or fails with err
+type fakeUsageSource struct {
+	name  string
+	usage map[string]*PodResources
+	err   error
+}
+
+func (s *fakeUsageSource) Name() string {
+	return s.name
+}
+
+func (s *fakeUsageSource) PodUsage(ctx context.Context) (map[string]*PodResources, error) {
+	return s.usage, s.err
+}
+
+func TestGetUsageCost(t *testing.T) {
+	node := &Node{Instance: &Instance{Type: "m5.large"}, Cost: &Ec2Cost{Type: "ondemand", VCpu: 0.04, Memory: 0.005}}
+	newPod := func(usageTime time.Time) *Pod {
+		return &Pod{Node: node, Resources: newPodResources("100m", "128Mi"), Usage: newPodResources("1", "1Gi"), UsageTime: usageTime}
+	}
+
+	reported := newPod(time.Time{})
+	recent := newPod(time.Now().Add(-time.Minute))
+	stale := newPod(time.Now().Add(-usageMaxAge - time.Minute))
+
+	m := newTestMetrics(&fakePricingProvider{})
+	m.Pods = map[string]*Pod{"default/reported": reported, "default/recent": recent, "default/stale": stale}
+	m.usage = &fakeUsageSource{name: "fake", usage: map[string]*PodResources{"default/reported": newPodResources("2", "2Gi")}}
+
+	usage, err := m.GetUsage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.updateUsageCost(usage)
+
+	tests := []struct {
+		name string
+		pod  *Pod
+		cpu  string
+	}{
+		{"reported by the source", reported, "2"},
+		{"missing with a recent usage", recent, "1"},
+		{"missing with a stale usage", stale, "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if want := resource.MustParse(tt.cpu); tt.pod.Usage.Cpu.Cmp(want) != 0 {
+				t.Errorf("got cpu usage %s, want %s", tt.pod.Usage.Cpu, tt.cpu)
+			}
+		})
+	}
+
+	if reported.UsageTime.IsZero() {
+		t.Error("usage time of the reported pod not set")
+	}
+	// charged for its requests
+	if want := 0.1*0.04 + 0.125*0.005; !almostEqual(stale.Cost, want) {
+		t.Errorf("got cost %v of the stale pod, want %v", stale.Cost, want)
+	}
+}
+
+func TestKubeletUsageSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/nodes/a/proxy/stats/summary":
+			fmt.Fprint(w, `{"pods": [
+				{"podRef": {"namespace": "default", "name": "web"}, "cpu": {"usageNanoCores": 250000000}, "memory": {"workingSetBytes": 134217728}},
+				{"podRef": {"namespace": "default", "name": "starting"}}
+			]}`)
+		default:
+			http.Error(w, "unreachable", http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		nodes   []string
+		pods    int
+		wantErr bool
+	}{
+		{"all nodes", []string{"a"}, 2, false},
+		{"some nodes failed", []string{"a", "b"}, 2, false},
+		{"all nodes failed", []string{"b"}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &KubeletUsageSource{client: client, nodes: func() []string { return tt.nodes }}
+
+			usage, err := source.PodUsage(context.Background())
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if len(usage) != tt.pods {
+				t.Fatalf("got usage of %d pods, want %d", len(usage), tt.pods)
+			}
+			if tt.pods == 0 {
+				return
+			}
+
+			web := usage["default/web"]
+			if web.Cpu.Cmp(resource.MustParse("250m")) != 0 || web.Memory.Cmp(resource.MustParse("128Mi")) != 0 {
+				t.Errorf("got usage %s and %s, want 250m and 128Mi", web.Cpu, web.Memory)
+			}
+			if starting := usage["default/starting"]; !starting.Cpu.IsZero() || !starting.Memory.IsZero() {
+				t.Errorf("got usage %s and %s of a pod without stats, want none", starting.Cpu, starting.Memory)
+			}
+		})
+	}
+}
+
+func TestFallbackUsageSource(t *testing.T) {
+	failed := &fakeUsageSource{name: "failed", err: errors.New("unavailable")}
+	working := &fakeUsageSource{name: "working", usage: map[string]*PodResources{"default/web": newPodResources("1", "1Gi")}}
+	other := &fakeUsageSource{name: "other", usage: map[string]*PodResources{}}
+
+	source := &FallbackUsageSource{sources: []UsageSource{failed, working, other}}
+	usage, err := source.PodUsage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := usage["default/web"]; !ok || source.active != "working" {
+		t.Errorf("got usage %v from %s, want the usage of working", usage, source.active)
+	}
+
+	source = &FallbackUsageSource{sources: []UsageSource{failed}}
+	if _, err := source.PodUsage(context.Background()); err == nil {
+		t.Error("got no error when all sources failed")
+	}
+}
+
+// blockingUsageSource answers only once the request is cancelled
+type blockingUsageSource struct{}
+
+func (s *blockingUsageSource) Name() string {
+	return "blocking"
+}
+
+func (s *blockingUsageSource) PodUsage(ctx context.Context) (map[string]*PodResources, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestGetUsageTimeout(t *testing.T) {
+	m := newTestMetrics(&fakePricingProvider{})
+	m.usage = &blockingUsageSource{}
+	m.computeInterval = 10 * time.Millisecond
+
+	if _, err := m.GetUsage(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want the query to time out after the compute interval", err)
+	}
+}
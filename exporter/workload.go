@@ -0,0 +1,96 @@
+package exporter
+
+import (
+	"context"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Workload identifies the top level controller of a pod
+type Workload struct {
+	Namespace string
+	Kind      string
+	Name      string
+}
+
+// GetOwners caches the ReplicaSets and Jobs, which are the intermediate owners between pods
+// and their Deployments and CronJobs
+func (m *Metrics) GetOwners(ctx context.Context) {
+	now := time.Now()
+	defer timeTrack(now, "Retrieving current ReplicaSet and Job list")
+
+	rsInformer := m.informers.Apps().V1().ReplicaSets()
+	jobInformer := m.informers.Batch().V1().Jobs()
+	m.replicaSets = rsInformer.Lister()
+	m.jobs = jobInformer.Lister()
+
+	m.informers.Start(ctx.Done())
+	cache.WaitForCacheSync(ctx.Done(), rsInformer.Informer().HasSynced, jobInformer.Informer().HasSynced)
+}
+
+// controllerOf returns the owner reference that manages the object, nil if there is none
+func controllerOf(owners []metav1.OwnerReference) *metav1.OwnerReference {
+	for i := range owners {
+		if owners[i].Controller != nil && *owners[i].Controller {
+			return &owners[i]
+		}
+	}
+
+	return nil
+}
+
+// workloadOf resolves the top level controller of a pod following its ownerReferences
+// (ReplicaSet to Deployment and Job to CronJob), pods without controller are their own workload
+func (m *Metrics) workloadOf(pod *Pod) Workload {
+	owner := controllerOf(pod.Owners)
+	if owner == nil {
+		return Workload{Namespace: pod.Namespace, Kind: "Pod", Name: pod.Name}
+	}
+
+	var obj metav1.Object
+	var err error
+	switch owner.Kind {
+	case "ReplicaSet":
+		obj, err = m.replicaSets.ReplicaSets(pod.Namespace).Get(owner.Name)
+	case "Job":
+		obj, err = m.jobs.Jobs(pod.Namespace).Get(owner.Name)
+	default:
+		return Workload{Namespace: pod.Namespace, Kind: owner.Kind, Name: owner.Name}
+	}
+	if err != nil {
+		// not in the cache yet or already deleted
+		return Workload{Namespace: pod.Namespace, Kind: owner.Kind, Name: owner.Name}
+	}
+
+	if parent := controllerOf(obj.GetOwnerReferences()); parent != nil {
+		return Workload{Namespace: pod.Namespace, Kind: parent.Kind, Name: parent.Name}
+	}
+
+	return Workload{Namespace: pod.Namespace, Kind: owner.Kind, Name: owner.Name}
+}
+
+// workloadCosts aggregates the cost of the pods by workload, caller must hold the pods lock and the nodes lock
+func (m *Metrics) workloadCosts() map[Workload]*Ec2Cost {
+	workloads := make(map[Workload]*Ec2Cost)
+	for _, pod := range m.Pods {
+		if pod.Node == nil || pod.Node.Cost == nil {
+			continue
+		}
+
+		w := m.workloadOf(pod)
+		cost, ok := workloads[w]
+		if !ok {
+			cost = &Ec2Cost{}
+			workloads[w] = cost
+		}
+
+		cost.Total += pod.Cost
+		cost.VCpu += max(pod.VCpuCost, pod.VCpuRequestsCost)
+		cost.Memory += max(pod.MemoryCost, pod.MemoryRequestsCost)
+		cost.Gpu += pod.GpuCost
+	}
+
+	return workloads
+}
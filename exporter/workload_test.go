@@ -0,0 +1,52 @@
+package exporter
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func controllerRef(kind, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &controller}}
+}
+
+func TestWorkloadOf(t *testing.T) {
+	replicaSets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	replicaSets.Add(&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-5d4f", OwnerReferences: controllerRef("Deployment", "web")}})
+	replicaSets.Add(&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "standalone"}})
+	jobs := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	jobs.Add(&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "backup-28000", OwnerReferences: controllerRef("CronJob", "backup")}})
+
+	m := newTestMetrics(&fakePricingProvider{})
+	m.replicaSets = appslisters.NewReplicaSetLister(replicaSets)
+	m.jobs = batchlisters.NewJobLister(jobs)
+
+	tests := []struct {
+		name   string
+		owners []metav1.OwnerReference
+		want   Workload
+	}{
+		{"without controller", nil, Workload{"default", "Pod", "pod"}},
+		{"deployment", controllerRef("ReplicaSet", "web-5d4f"), Workload{"default", "Deployment", "web"}},
+		{"replicaset without owner", controllerRef("ReplicaSet", "standalone"), Workload{"default", "ReplicaSet", "standalone"}},
+		{"replicaset not cached", controllerRef("ReplicaSet", "deleted"), Workload{"default", "ReplicaSet", "deleted"}},
+		{"cronjob", controllerRef("Job", "backup-28000"), Workload{"default", "CronJob", "backup"}},
+		{"statefulset", controllerRef("StatefulSet", "db"), Workload{"default", "StatefulSet", "db"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := m.workloadOf(&Pod{Namespace: "default", Name: "pod", Owners: tt.owners})
+
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,9 +2,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/AndreZiviani/eks-cost-exporter/exporter"
 	"github.com/prometheus/client_golang/prometheus"
@@ -13,11 +19,32 @@ import (
 )
 
 var (
-	addr          = flag.String("listen-address", ":8080", "The address to listen on for HTTP requests.")
-	metricsPath   = flag.String("metrics-path", "/metrics", "path to metrics endpoint")
-	rawLevel      = flag.String("log-level", "info", "log level")
-	addPodLabels  = flag.String("add-pod-labels", "", "Comma separated list of pod labels that should be added to the cost_pod metric")
-	addNodeLabels = flag.String("add-node-labels", "", "Comma separated list of node labels that should be added to the cost_node metric")
+	configFile             = flag.String("config", "", "YAML configuration file, its settings take precedence over the flags and it is reloaded when changed")
+	addr                   = flag.String("listen-address", ":8080", "The address to listen on for HTTP requests.")
+	metricsPath            = flag.String("metrics-path", "/metrics", "path to metrics endpoint")
+	rawLevel               = flag.String("log-level", "info", "log level")
+	addPodLabels           = flag.String("add-pod-labels", "", "Comma separated list of pod labels that should be added to the cost_pod metric")
+	addNodeLabels          = flag.String("add-node-labels", "", "Comma separated list of node labels that should be added to the cost_node metric")
+	addNamespaceLabels     = flag.String("add-namespace-labels", "", "Comma separated list of namespace labels that should be added to the cost_namespace metric")
+	addNamespaceAnnots     = flag.String("add-namespace-annotations", "", "Comma separated list of namespace annotations that should be added to the cost_namespace metric, prefixed with annotation_")
+	pricingFile            = flag.String("pricing-file", "", "Load prices from a price-list file or directory instead of the AWS Pricing API, see the download-pricing command")
+	pricingRefreshInterval = flag.Duration("pricing-refresh-interval", time.Hour, "How often prices are refreshed, 0 disables it")
+	pricingCacheFile       = flag.String("pricing-cache-file", "", "File where prices are cached between restarts, empty disables the cache")
+	pricingCacheTTL        = flag.Duration("pricing-cache-ttl", 24*time.Hour, "How long cached prices are used before being refreshed")
+	overridesFile          = flag.String("pricing-overrides-file", "", "YAML file with discounts and custom rates applied on top of the retrieved prices")
+	cpuMemRatioStrategy    = flag.String("cpu-memory-ratio-strategy", exporter.RatioStrategyConstant, "How instance prices are split between vCPU and memory: constant or regression")
+	cpuMemRatio            = flag.Float64("cpu-memory-ratio", exporter.DefaultCpuMemRelation, "How many times one vCPU costs more than one GB of memory, used by the constant strategy")
+	cpuMemRatioOverrides   = flag.String("cpu-memory-ratio-overrides", "", "Comma separated list of family=ratio pairs that override the cpu/memory ratio strategy, e.g. c5=9,r5=5")
+	idleAllocation         = flag.String("idle-allocation", exporter.IdleAllocationNone, "How node idle cost is redistributed to its pods in the cost_pod_total_with_idle metric: none, requests, usage or max")
+	controlPlaneSupport    = flag.String("control-plane-support", exporter.ControlPlaneSupportAuto, "Support tier of the cluster Kubernetes version used to price the control plane: standard, extended or auto to select it from the cluster version")
+	controlPlaneAllocation = flag.String("control-plane-allocation", exporter.ControlPlaneAllocationNone, "How the control plane cost is distributed in the cost_namespace_control_plane metric: none or compute, proportionally to the namespace compute cost")
+	computeInterval        = flag.Duration("compute-interval", 30*time.Second, "How often pod usage is refreshed and costs are computed, scrapes are served from the last computation")
+	usageSource            = flag.String("usage-source", exporter.UsageSourceAuto, "Where pod usage is read from: metrics-server, kubelet, prometheus, requests or auto to fall back from prometheus (if configured) to metrics-server to kubelet to requests")
+	prometheusURL          = flag.String("prometheus-url", "", "Address of the Prometheus compatible API used by the prometheus usage source, e.g. http://prometheus:9090")
+	usageWindow            = flag.Duration("usage-window", 5*time.Minute, "Window the prometheus usage source averages pod usage over")
+	accountingInterval     = flag.Duration("accounting-interval", 15*time.Second, "How often hourly costs are integrated into the spent_dollars_total counters, 0 disables them")
+	stateFile              = flag.String("state-file", "", "File where the spent_dollars_total counters are persisted between restarts, empty disables it")
+	commitmentsFile        = flag.String("commitments-file", "", "YAML file describing the savings plans and reserved instances covering on-demand nodes")
 )
 
 func init() {
@@ -36,37 +63,263 @@ func main() {
 
 	ctx := context.TODO()
 
+	if flag.Arg(0) == "download-pricing" {
+		downloadPricing(ctx, flag.Args()[1:])
+		return
+	}
+
 	registry := prometheus.NewRegistry()
 
-	podLabels := []string{}
-	if len(*addPodLabels) > 0 {
-		podLabels = strings.Split(strings.ReplaceAll(*addPodLabels, " ", ""), ",")
+	base := baseConfig()
+	cfg, err := loadConfig(*configFile, base)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := exporter.ValidateRatioStrategy(*cpuMemRatioStrategy); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := exporter.ValidateRatio(*cpuMemRatio); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := exporter.ValidateUsageSource(*usageSource); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := exporter.ValidateUsageWindow(*usageWindow); err != nil {
+		log.Fatal(err)
+	}
+
+	var provider exporter.PricingProvider
+	if len(*pricingFile) > 0 {
+		provider, err = exporter.NewFilePricingProvider(*pricingFile, cfg.Region, cfg.PricingFilters)
+	} else {
+		provider, err = exporter.NewAWSPricingProvider(ctx, cfg.Region, cfg.PricingFilters)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var commitments *exporter.Commitments
+	if len(*commitmentsFile) > 0 {
+		commitments, err = exporter.LoadCommitments(*commitmentsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ratioOverrides, err := parseRatios(*cpuMemRatioOverrides)
+	if err != nil {
+		log.Fatal(err)
 	}
-	nodeLabels := []string{}
-	if len(*addNodeLabels) > 0 {
-		nodeLabels = strings.Split(strings.ReplaceAll(*addNodeLabels, " ", ""), ",")
+
+	var overrides *exporter.PricingOverrides
+	if len(*overridesFile) > 0 {
+		overrides, err = exporter.LoadPricingOverrides(*overridesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	_, err := exporter.NewMetrics(ctx, registry, podLabels, nodeLabels)
+	// probes are served while prices are loaded and the informers sync, the exporter reports
+	// not ready until NewMetrics returns
+	var current atomic.Pointer[exporter.Metrics]
+	log.Infof("Starting metric http endpoint [address=%s, path=%s]", cfg.ListenAddress, cfg.MetricsPath)
+	http.Handle(cfg.MetricsPath, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	http.HandleFunc("/healthz", healthzHandler)
+	http.HandleFunc("/readyz", readyzHandler(&current))
+	http.HandleFunc("/status", statusHandler(&current))
+	http.HandleFunc("/", rootHandler(cfg.MetricsPath))
+	go func() {
+		log.Fatal(http.ListenAndServe(cfg.ListenAddress, nil))
+	}()
+
+	metrics, err := exporter.NewMetrics(ctx, registry, provider, exporter.Options{
+		PodLabels:              cfg.PodLabels,
+		NodeLabels:             cfg.NodeLabels,
+		NamespaceLabels:        cfg.NamespaceLabels,
+		NamespaceAnnotations:   cfg.NamespaceAnnotations,
+		PricingRefreshInterval: cfg.PricingRefreshInterval.Duration,
+		PricingCacheFile:       *pricingCacheFile,
+		PricingCacheTTL:        *pricingCacheTTL,
+		Commitments:            commitments,
+		Overrides:              overrides,
+		CpuMemRatioStrategy:    *cpuMemRatioStrategy,
+		CpuMemRatio:            *cpuMemRatio,
+		CpuMemRatioOverrides:   ratioOverrides,
+		IdleAllocation:         cfg.IdleAllocation,
+		ControlPlaneSupport:    cfg.ControlPlaneSupport,
+		ControlPlaneAllocation: cfg.ControlPlaneAllocation,
+		ComputeInterval:        cfg.ComputeInterval.Duration,
+		UsageSource:            *usageSource,
+		PrometheusURL:          *prometheusURL,
+		UsageWindow:            *usageWindow,
+		AccountingInterval:     cfg.AccountingInterval.Duration,
+		StateFile:              *stateFile,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
+	current.Store(metrics)
 
-	log.Infof("Starting metric http endpoint [address=%s, path=%s]", *addr, *metricsPath)
-	http.Handle(*metricsPath, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
-	http.HandleFunc("/", rootHandler)
-	log.Fatal(http.ListenAndServe(*addr, nil))
+	if len(*configFile) > 0 {
+		if err := metrics.WatchConfig(ctx, *configFile, base, cfg); err != nil {
+			log.WithError(err).Warn("Failed to watch config, changes will require a restart")
+		}
+	}
+
+	select {}
 }
 
-func rootHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`<html>
+// baseConfig returns the configuration set by the command line flags
+func baseConfig() exporter.Config {
+	return exporter.Config{
+		ListenAddress:          *addr,
+		MetricsPath:            *metricsPath,
+		LogLevel:               log.GetLevel().String(),
+		PodLabels:              splitList(*addPodLabels),
+		NodeLabels:             splitList(*addNodeLabels),
+		NamespaceLabels:        splitList(*addNamespaceLabels),
+		NamespaceAnnotations:   splitList(*addNamespaceAnnots),
+		Region:                 os.Getenv("AWS_REGION"),
+		IdleAllocation:         *idleAllocation,
+		ControlPlaneSupport:    *controlPlaneSupport,
+		ControlPlaneAllocation: *controlPlaneAllocation,
+		PricingRefreshInterval: exporter.Duration{Duration: *pricingRefreshInterval},
+		ComputeInterval:        exporter.Duration{Duration: *computeInterval},
+		AccountingInterval:     exporter.Duration{Duration: *accountingInterval},
+	}
+}
+
+// loadConfig overlays the configuration file at path, if any, on base and applies its log level
+func loadConfig(path string, base exporter.Config) (*exporter.Config, error) {
+	if len(path) == 0 {
+		return &base, base.Validate()
+	}
+
+	cfg, err := exporter.LoadConfig(path, base)
+	if err != nil {
+		return nil, err
+	}
+
+	if level, err := log.ParseLevel(cfg.LogLevel); err == nil {
+		log.SetLevel(level)
+	}
+
+	return cfg, nil
+}
+
+// splitList parses a comma separated list
+func splitList(value string) []string {
+	if len(value) == 0 {
+		return []string{}
+	}
+
+	return strings.Split(strings.ReplaceAll(value, " ", ""), ",")
+}
+
+// parseRatios parses a comma separated list of family=ratio pairs
+func parseRatios(value string) (map[string]float64, error) {
+	ratios := map[string]float64{}
+	if len(value) == 0 {
+		return ratios, nil
+	}
+
+	for _, pair := range strings.Split(strings.ReplaceAll(value, " ", ""), ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid cpu/memory ratio override %q, expected family=ratio", pair)
+		}
+
+		ratio, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil || exporter.ValidateRatio(ratio) != nil {
+			return nil, fmt.Errorf("invalid cpu/memory ratio override %q, ratio must be a positive number", pair)
+		}
+
+		ratios[kv[0]] = ratio
+	}
+
+	return ratios, nil
+}
+
+func downloadPricing(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("download-pricing", flag.ExitOnError)
+	outputDir := fs.String("output-dir", ".", "Directory where the price-list files are written")
+	config := fs.String("config", *configFile, "YAML configuration file whose region and pricingFilters select the downloaded prices")
+	region := fs.String("region", "", "Region of the downloaded prices, defaults to the configuration file region or the AWS_REGION environment variable")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*config, baseConfig())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(*region) > 0 {
+		cfg.Region = *region
+	}
+
+	log.Infof("Downloading price lists. [output-dir=%s, region=%s]", *outputDir, cfg.Region)
+
+	if err := exporter.DownloadPriceLists(ctx, *outputDir, cfg.Region, cfg.PricingFilters); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func rootHandler(metricsPath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`<html>
 		<head><title>EKS Cost Exporter</title></head>
 		<body>
 		<h1>EKS Cost Exporter</h1>
-		<p><a href="` + *metricsPath + `">Metrics</a></p>
+		<p><a href="` + metricsPath + `">Metrics</a></p>
+		<p><a href="/status">Status</a></p>
 		</body>
 		</html>
 	`))
+	}
+}
 
+// healthzHandler reports the process is alive, it does not depend on the state of the data sources
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// readyzHandler reports the exporter ready once it started, pricing is loaded and the nodes and pods are cached
+func readyzHandler(current *atomic.Pointer[exporter.Metrics]) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metrics := current.Load()
+		if metrics == nil || !metrics.Health().Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("not ready"))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}
+}
+
+// statusHandler shows the state of the exporter data sources as JSON
+func statusHandler(current *atomic.Pointer[exporter.Metrics]) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var health exporter.HealthStatus
+		metrics := current.Load()
+		if metrics != nil {
+			health = metrics.Health()
+		}
+
+		status := struct {
+			exporter.HealthStatus
+			Started bool `json:"started"`
+			Ready   bool `json:"ready"`
+		}{health, metrics != nil, metrics != nil && health.Ready()}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			log.WithError(err).Warn("Failed to write status")
+		}
+	}
 }